@@ -0,0 +1,87 @@
+package ultramux
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// AccessRule - правило доступа к HTTP эндпоинтам. Правила проверяются по
+// порядку, решает первое подошедшее; если не подошло ни одно, запрос
+// пропускается
+type AccessRule struct {
+	// Allow - разрешить (true) или запретить с 403 (false)
+	Allow bool
+	// Methods - HTTP методы; пустой - любые
+	Methods []string
+	// Path - шаблон пути path.Match ("/proxy", "/api/*"); "/prefix/**"
+	// покрывает все вложенные пути
+	Path string
+	// Roles - правило подходит, только если у Identity есть одна из ролей.
+	// Пустой - подходит любому запросу, в том числе без аутентификации
+	Roles []string
+}
+
+func (rule AccessRule) matches(r *http.Request, identity Identity, authenticated bool) bool {
+	if len(rule.Methods) > 0 && !methodAllowed(r.Method, rule.Methods) {
+		return false
+	}
+	if !matchPathPattern(rule.Path, r.URL.Path) {
+		return false
+	}
+	if len(rule.Roles) == 0 {
+		return true
+	}
+	if !authenticated {
+		return false
+	}
+	for _, role := range rule.Roles {
+		for _, has := range identity.Roles {
+			if role == has {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchPathPattern(pattern, p string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return p == prefix || strings.HasPrefix(p, prefix+"/")
+	}
+	matched, _ := path.Match(pattern, p)
+	return matched
+}
+
+// validateAccessRules проверяет шаблоны заранее: path.Match молча
+// не совпадет с битым шаблоном, и правило не сработает
+func (um *UltraMultiplexer) validateAccessRules() error {
+	for i, rule := range um.config.AccessRules {
+		pattern := strings.TrimSuffix(rule.Path, "/**")
+		if _, err := path.Match(pattern, "/"); err != nil || rule.Path == "" {
+			return fmt.Errorf("%w: access rule %d: bad path pattern %q", ErrInvalidConfig, i, rule.Path)
+		}
+	}
+	return nil
+}
+
+// accessControlMiddleware применяет Config.AccessRules после аутентификации
+func (um *UltraMultiplexer) accessControlMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, authenticated := IdentityFromContext(r.Context())
+		for _, rule := range um.config.AccessRules {
+			if !rule.matches(r, identity, authenticated) {
+				continue
+			}
+			if !rule.Allow {
+				um.logger.Printf("⚠️ Access denied: %s %s for %q", r.Method, r.URL.Path, identity.Subject)
+				um.metrics.Inc("http_access_denied_total")
+				um.writeError(w, r, http.StatusForbidden, "forbidden")
+				return
+			}
+			break
+		}
+		next.ServeHTTP(w, r)
+	})
+}
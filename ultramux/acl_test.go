@@ -0,0 +1,67 @@
+package ultramux
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccessRulesOrder(t *testing.T) {
+	config := DefaultConfig()
+	config.AccessRules = []AccessRule{
+		{Allow: true, Path: "/reports/**", Roles: []string{"admin"}},
+		{Allow: false, Path: "/reports/**"},
+		{Allow: true, Methods: []string{http.MethodGet}, Path: "/api/*"},
+		{Allow: false, Path: "/api/*"},
+	}
+	um := NewUltraMultiplexer(WithConfig(config))
+	handler := um.accessControlMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	admin := &Identity{Subject: "alice", Roles: []string{"admin"}}
+	user := &Identity{Subject: "bob", Roles: []string{"user"}}
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		identity *Identity
+		want     int
+	}{
+		{"role allows prefix itself", http.MethodGet, "/reports", admin, http.StatusOK},
+		{"role allows nested path", http.MethodGet, "/reports/2024/q1", admin, http.StatusOK},
+		{"other role falls to deny", http.MethodGet, "/reports/2024/q1", user, http.StatusForbidden},
+		{"unauthenticated falls to deny", http.MethodGet, "/reports", nil, http.StatusForbidden},
+		{"** matches only whole segments", http.MethodGet, "/reportsx", nil, http.StatusOK},
+		{"method rule allows", http.MethodGet, "/api/items", nil, http.StatusOK},
+		{"method rule skipped", http.MethodPost, "/api/items", admin, http.StatusForbidden},
+		{"* does not cross segments", http.MethodPost, "/api/items/1", nil, http.StatusOK},
+		{"no rule matches", http.MethodDelete, "/echo", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.identity != nil {
+				req = req.WithContext(context.WithValue(req.Context(), identityKey{}, *tt.identity))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAccessRules(t *testing.T) {
+	for _, pattern := range []string{"", "/api/[", "/api/[/**"} {
+		config := DefaultConfig()
+		config.AccessRules = []AccessRule{{Path: pattern}}
+		um := NewUltraMultiplexer(WithConfig(config))
+		if err := um.validateAccessRules(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("pattern %q: error = %v, want ErrInvalidConfig", pattern, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package ultramux
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/connectivity"
+
+	pb "ultramultiplexer/pb/pb"
+)
+
+// adminOnly пускает к обработчику только запросы с заголовком
+// Authorization: Bearer <Config.AdminToken>. Без токена админка выключена.
+func (h *HTTPHandler) adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := h.multiplexer.config.AdminToken
+		if token == "" {
+			h.multiplexer.writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			h.multiplexer.writeError(w, r, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (h *HTTPHandler) reconnectGRPCHandler(w http.ResponseWriter, r *http.Request) {
+	state, err := h.multiplexer.ReconnectGRPC(r.Context())
+	response := map[string]interface{}{
+		"state": state.String(),
+		"ready": h.multiplexer.isGRPCClientReady(),
+	}
+	code := http.StatusOK
+	if err != nil {
+		response["error"] = err.Error()
+		code = http.StatusBadGateway
+	}
+	h.multiplexer.writeJSON(w, code, response)
+}
+
+// ReconnectGRPC устанавливает внутреннее gRPC соединение заново и только
+// после успешного подключения закрывает старое: при ошибке мост продолжает
+// работать через прежнее. Возвращает состояние нового соединения.
+func (um *UltraMultiplexer) ReconnectGRPC(ctx context.Context) (connectivity.State, error) {
+	um.reconnectMu.Lock()
+	defer um.reconnectMu.Unlock()
+
+	if lifecycle := um.Lifecycle(); lifecycle != LifecycleRunning {
+		return connectivity.Shutdown, fmt.Errorf("%w: multiplexer is %s", ErrGRPCClientInit, lifecycle)
+	}
+
+	um.logger.Println("🔁 Reconnecting internal gRPC client...")
+	conn, err := um.dialGRPCClient(ctx)
+	if err != nil {
+		return connectivity.TransientFailure, err
+	}
+
+	um.mu.Lock()
+	if um.lifecycle >= LifecycleStopping {
+		// Остановка уже закрыла текущее соединение, новое никто не закроет
+		um.mu.Unlock()
+		conn.Close()
+		return connectivity.Shutdown, ErrStopped
+	}
+	old := um.grpcConn
+	um.grpcConn = conn
+	um.grpcClient = pb.NewUltraServiceClient(conn)
+	um.serverReady = true
+	um.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	um.logger.Println("✅ gRPC client successfully reconnected!")
+	return conn.GetState(), nil
+}
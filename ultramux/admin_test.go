@@ -0,0 +1,72 @@
+package ultramux
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestAdminOnly(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		want          int
+	}{
+		{"admin disabled", "", "Bearer secret", http.StatusNotFound},
+		{"wrong token", "secret", "Bearer guess", http.StatusUnauthorized},
+		{"no token", "secret", "", http.StatusUnauthorized},
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.AdminToken = tt.token
+			h := newHTTPHandler(NewUltraMultiplexer(WithConfig(config)), nil)
+			handler := h.adminOnly(func(w http.ResponseWriter, r *http.Request) {})
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/requests", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconnectGRPC(t *testing.T) {
+	um := newTestMultiplexer(t, DefaultConfig())
+	if _, err := um.ReconnectGRPC(context.Background()); !errors.Is(err, ErrGRPCClientInit) {
+		t.Fatalf("reconnect before start = %v, want ErrGRPCClientInit", err)
+	}
+	startTestMultiplexer(t, um)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !um.isGRPCClientReady() {
+		if time.Now().After(deadline) {
+			t.Fatal("gRPC client never became ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	old := um.currentGRPCConn()
+
+	if _, err := um.ReconnectGRPC(context.Background()); err != nil {
+		t.Fatalf("ReconnectGRPC: %v", err)
+	}
+	if um.currentGRPCConn() == old {
+		t.Fatal("connection not replaced")
+	}
+	// Старое соединение закрывается только после подмены
+	if state := old.GetState(); state != connectivity.Shutdown {
+		t.Fatalf("old connection state = %s, want SHUTDOWN", state)
+	}
+}
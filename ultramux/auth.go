@@ -0,0 +1,208 @@
+package ultramux
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Credentials - то, что клиент предъявил для аутентификации. Для HTTP
+// берется из заголовков, для gRPC - из одноименных метаданных
+type Credentials struct {
+	// Protocol - "HTTP" или "gRPC"
+	Protocol string
+	// Method - путь HTTP запроса или полное имя gRPC метода
+	Method string
+	// Authorization - значение Authorization целиком, например "Bearer <jwt>"
+	Authorization string
+	// APIKey - значение X-API-Key
+	APIKey string
+	// RemoteAddr - адрес клиента
+	RemoteAddr string
+}
+
+// Identity - результат успешной аутентификации, доступен обработчикам
+// через IdentityFromContext
+type Identity struct {
+	Subject string
+	// Roles проверяются правилами Config.AccessRules
+	Roles  []string
+	Claims map[string]interface{}
+}
+
+// Authenticator проверяет учетные данные (JWT, интроспекция OAuth, HMAC...).
+// Ошибка со статусом gRPC (например, codes.PermissionDenied) отдается
+// клиенту с этим кодом, любая другая - как Unauthenticated / 401
+type Authenticator interface {
+	Authenticate(ctx context.Context, creds Credentials) (Identity, error)
+}
+
+type identityKey struct{}
+type credentialsKey struct{}
+
+// IdentityFromContext возвращает Identity аутентифицированного запроса
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// SetAuthenticator включает аутентификацию HTTP запросов и gRPC вызовов.
+// Пути из Config.AuthSkipPaths и gRPC health проверки не аутентифицируются;
+// запросы TLS арендатора могут использовать Tenant.Authenticator.
+// Должен вызываться до Initialize.
+func (um *UltraMultiplexer) SetAuthenticator(auth Authenticator) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.authenticator = auth
+}
+
+func authSkipped(path string, skipPaths []string) bool {
+	// Админка защищена собственным токеном
+	if strings.HasPrefix(path, "/admin/") {
+		return true
+	}
+	for _, skip := range skipPaths {
+		if path == skip {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateWith вызывает auth и кладет Identity в контекст
+func (um *UltraMultiplexer) authenticateWith(ctx context.Context, auth Authenticator, creds Credentials) (context.Context, error) {
+	identity, err := auth.Authenticate(ctx, creds)
+	if err != nil {
+		um.metrics.Inc("auth_failures_total")
+		if _, ok := status.FromError(err); !ok {
+			err = status.Error(codes.Unauthenticated, err.Error())
+		}
+		return ctx, err
+	}
+	ctx = context.WithValue(ctx, identityKey{}, identity)
+	return context.WithValue(ctx, credentialsKey{}, creds), nil
+}
+
+func (um *UltraMultiplexer) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, skipPaths := um.authenticator, um.config.AuthSkipPaths
+		if _, tenant := tenantFromContext(r.Context()); tenant != nil {
+			if tenant.Authenticator != nil {
+				auth = tenant.Authenticator
+			}
+			if tenant.AuthSkipPaths != nil {
+				skipPaths = tenant.AuthSkipPaths
+			}
+		}
+		// Аутентификатор задан только у других арендаторов
+		if auth == nil || authSkipped(r.URL.Path, skipPaths) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, err := um.authenticateWith(r.Context(), auth, Credentials{
+			Protocol:      "HTTP",
+			Method:        r.URL.Path,
+			Authorization: r.Header.Get("Authorization"),
+			APIKey:        r.Header.Get("X-API-Key"),
+			RemoteAddr:    r.RemoteAddr,
+		})
+		if err != nil {
+			st := status.Convert(err)
+			um.logger.Printf("⚠️ HTTP auth failed for %s %s from %s: %s", r.Method, r.URL.Path, clientHost(r.RemoteAddr), st.Message())
+			if st.Code() == codes.Unauthenticated {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			um.writeError(w, r, httpStatusFromGRPC(st.Code()), st.Message())
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authRequired: health проверки балансировщиков идут без учетных данных
+func authRequired(method string) bool {
+	return !strings.HasPrefix(method, "/grpc.health.v1.")
+}
+
+func grpcCredentials(ctx context.Context, method string) Credentials {
+	creds := Credentials{Protocol: "gRPC", Method: method}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			creds.Authorization = values[0]
+		}
+		if values := md.Get("x-api-key"); len(values) > 0 {
+			creds.APIKey = values[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		creds.RemoteAddr = p.Addr.String()
+	}
+	return creds
+}
+
+// grpcAuthenticator - Authenticator арендатора вызова или общий; nil -
+// вызов не аутентифицируется (аутентификатор задан только у других арендаторов)
+func (um *UltraMultiplexer) grpcAuthenticator(ctx context.Context) Authenticator {
+	if _, tenant := um.grpcTenant(ctx); tenant != nil && tenant.Authenticator != nil {
+		return tenant.Authenticator
+	}
+	return um.authenticator
+}
+
+func (um *UltraMultiplexer) authUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !authRequired(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	auth := um.grpcAuthenticator(ctx)
+	if auth == nil {
+		return handler(ctx, req)
+	}
+	ctx, err := um.authenticateWith(ctx, auth, grpcCredentials(ctx, info.FullMethod))
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (um *UltraMultiplexer) authStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !authRequired(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	auth := um.grpcAuthenticator(ss.Context())
+	if auth == nil {
+		return handler(srv, ss)
+	}
+	ctx, err := um.authenticateWith(ss.Context(), auth, grpcCredentials(ss.Context(), info.FullMethod))
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
+
+// forwardCredentials передает учетные данные и арендатора HTTP запроса во
+// внутренние gRPC вызовы моста, иначе gRPC сервер отклонил бы их повторной
+// проверкой. Внутренний клиент подключается без SNI арендатора, поэтому
+// арендатор идет в метаданных вместе с bridgeToken
+func (um *UltraMultiplexer) forwardCredentials(ctx context.Context) context.Context {
+	if name, _ := tenantFromContext(ctx); name != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, bridgeTenantKey, name, bridgeTokenKey, um.bridgeToken)
+	}
+	creds, ok := ctx.Value(credentialsKey{}).(Credentials)
+	if !ok {
+		return ctx
+	}
+	if creds.Authorization != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", creds.Authorization)
+	}
+	if creds.APIKey != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", creds.APIKey)
+	}
+	return ctx
+}
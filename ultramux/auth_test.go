@@ -0,0 +1,148 @@
+package ultramux
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type acceptAllAuthenticator struct{}
+
+func (acceptAllAuthenticator) Authenticate(context.Context, Credentials) (Identity, error) {
+	return Identity{Subject: "tenant"}, nil
+}
+
+// tokenAuthenticator пускает "Bearer good", отказывает "Bearer banned" с
+// PermissionDenied, остальным - обычной ошибкой
+type tokenAuthenticator struct{}
+
+func (tokenAuthenticator) Authenticate(_ context.Context, creds Credentials) (Identity, error) {
+	switch creds.Authorization {
+	case "Bearer good":
+		return Identity{Subject: "alice", Roles: []string{"admin"}}, nil
+	case "Bearer banned":
+		return Identity{}, status.Error(codes.PermissionDenied, "banned")
+	default:
+		return Identity{}, errors.New("bad token")
+	}
+}
+
+func TestAuthMiddlewareStatuses(t *testing.T) {
+	um := NewUltraMultiplexer()
+	um.SetAuthenticator(tokenAuthenticator{})
+	handler := um.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := IdentityFromContext(r.Context())
+		w.Write([]byte(identity.Subject))
+	}))
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+		wantChallenge bool
+		wantBody      string
+	}{
+		{"valid token", "Bearer good", http.StatusOK, false, "alice"},
+		{"permission denied", "Bearer banned", http.StatusForbidden, false, ""},
+		{"invalid token", "Bearer bad", http.StatusUnauthorized, true, ""},
+		{"no token", "", http.StatusUnauthorized, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/echo", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if got := rec.Header().Get("WWW-Authenticate") != ""; got != tt.wantChallenge {
+				t.Fatalf("WWW-Authenticate present = %v, want %v", got, tt.wantChallenge)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Fatalf("body = %q, want %q", rec.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAuthUnaryInterceptorCodes(t *testing.T) {
+	um := NewUltraMultiplexer()
+	um.SetAuthenticator(tokenAuthenticator{})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		identity, _ := IdentityFromContext(ctx)
+		return identity.Subject, nil
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		authorization string
+		want          codes.Code
+		wantSubject   string
+	}{
+		{"valid token", "/ultramux.test.Ping/Ping", "Bearer good", codes.OK, "alice"},
+		{"permission denied", "/ultramux.test.Ping/Ping", "Bearer banned", codes.PermissionDenied, ""},
+		{"invalid token", "/ultramux.test.Ping/Ping", "Bearer bad", codes.Unauthenticated, ""},
+		{"health skipped", "/grpc.health.v1.Health/Check", "", codes.OK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.authorization != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tt.authorization))
+			}
+			resp, err := um.authUnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if status.Code(err) != tt.want {
+				t.Fatalf("code = %s, want %s", status.Code(err), tt.want)
+			}
+			if err == nil && resp != tt.wantSubject {
+				t.Fatalf("subject = %v, want %q", resp, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareTenantOverrides(t *testing.T) {
+	um := NewUltraMultiplexer()
+	um.SetAuthenticator(rejectAllAuthenticator{})
+	handler := um.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		tenant *Tenant
+		path   string
+		want   int
+	}{
+		{"default", nil, "/echo", http.StatusUnauthorized},
+		{"default skip path", nil, "/health", http.StatusOK},
+		{"tenant authenticator", &Tenant{Authenticator: acceptAllAuthenticator{}}, "/echo", http.StatusOK},
+		{"tenant skip paths", &Tenant{AuthSkipPaths: []string{"/echo"}}, "/echo", http.StatusOK},
+		{"tenant replaces skip paths", &Tenant{AuthSkipPaths: []string{}}, "/health", http.StatusUnauthorized},
+		{"tenant inherits authenticator", &Tenant{}, "/echo", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.tenant != nil {
+				req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, &tenantInfo{name: "a.example", tenant: *tt.tenant}))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
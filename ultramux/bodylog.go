@@ -0,0 +1,137 @@
+package ultramux
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ProxyBodyLogConfig - отладочное логирование тел запросов и ответов /proxy.
+// Работает только вместе с DebugEnabled.
+type ProxyBodyLogConfig struct {
+	Enabled bool
+	// MaxBytes - сколько байт начала тела попадает в лог (по умолчанию 2 KiB)
+	MaxBytes int
+	// ContentTypes - разрешенные типы; префикс с "/" на конце ("text/")
+	// покрывает все подтипы. По умолчанию JSON, XML, формы и text/*
+	ContentTypes []string
+	// PerSecond - не больше стольких залогированных запросов в секунду (по умолчанию 1)
+	PerSecond float64
+}
+
+var defaultBodyLogContentTypes = []string{
+	"application/json",
+	"application/xml",
+	"application/x-www-form-urlencoded",
+	"text/",
+}
+
+func bodyLogRate(cfg ProxyBodyLogConfig) float64 {
+	if cfg.PerSecond <= 0 {
+		return 1
+	}
+	return cfg.PerSecond
+}
+
+// bodyCapture сохраняет первые limit байт и молча отбрасывает остальное
+type bodyCapture struct {
+	buf   bytes.Buffer
+	limit int
+	total int64
+}
+
+func (c *bodyCapture) Write(p []byte) (int, error) {
+	c.total += int64(len(p))
+	if room := c.limit - c.buf.Len(); room > 0 {
+		if len(p) > room {
+			c.buf.Write(p[:room])
+		} else {
+			c.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// proxyBodyLogger живет в рамках одного запроса к /proxy
+type proxyBodyLogger struct {
+	cfg      ProxyBodyLogConfig
+	um       *UltraMultiplexer
+	request  *bodyCapture
+	response *bodyCapture
+
+	requestHeader  http.Header
+	responseHeader http.Header
+}
+
+func (um *UltraMultiplexer) newProxyBodyLogger() *proxyBodyLogger {
+	cfg := um.config.ProxyBodyLog
+	if !um.config.DebugEnabled || !cfg.Enabled || !um.bodyLogLimiter.allow() {
+		return nil
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 2 << 10
+	}
+	if len(cfg.ContentTypes) == 0 {
+		cfg.ContentTypes = defaultBodyLogContentTypes
+	}
+	return &proxyBodyLogger{cfg: cfg, um: um}
+}
+
+func (l *proxyBodyLogger) loggable(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range l.cfg.ContentTypes {
+		if mediaType == allowed || (strings.HasSuffix(allowed, "/") && strings.HasPrefix(mediaType, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// wrap подменяет тело на TeeReader, не ломая стриминг
+func (l *proxyBodyLogger) wrap(body io.ReadCloser, header http.Header) (io.ReadCloser, *bodyCapture) {
+	if body == nil || body == http.NoBody || !l.loggable(header.Get("Content-Type")) {
+		return body, nil
+	}
+	capture := &bodyCapture{limit: l.cfg.MaxBytes}
+	return teeReadCloser{Reader: io.TeeReader(body, capture), Closer: body}, capture
+}
+
+func (l *proxyBodyLogger) wrapRequest(req *http.Request) {
+	req.Body, l.request = l.wrap(req.Body, req.Header)
+	l.requestHeader = req.Header
+}
+
+func (l *proxyBodyLogger) wrapResponse(resp *http.Response) {
+	resp.Body, l.response = l.wrap(resp.Body, resp.Header)
+	l.responseHeader = resp.Header
+}
+
+func (l *proxyBodyLogger) log(method, target string, status int) {
+	l.um.logger.Printf("🐛 Proxy %s %s -> %d\n  request headers: %s\n  request body: %s\n  response headers: %s\n  response body: %s",
+		method, target, status,
+		l.um.formatHeaders(l.requestHeader), describeCapture(l.request),
+		l.um.formatHeaders(l.responseHeader), describeCapture(l.response))
+}
+
+func describeCapture(c *bodyCapture) string {
+	if c == nil {
+		return "(not logged)"
+	}
+	body := strconv.Quote(c.buf.String())
+	if c.total > int64(c.buf.Len()) {
+		body += fmt.Sprintf(" ...(%d bytes total)", c.total)
+	}
+	return body
+}
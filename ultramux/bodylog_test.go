@@ -0,0 +1,71 @@
+package ultramux
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxyBodyLog(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		io.WriteString(w, `{"result":"done"}`)
+	}))
+	defer upstream.Close()
+
+	var out bytes.Buffer
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	config := DefaultConfig()
+	config.DebugEnabled = true
+	config.ProxyAllowedMethods = []string{http.MethodPost}
+	config.ProxyBodyLog = ProxyBodyLogConfig{Enabled: true, MaxBytes: 8}
+	um := NewUltraMultiplexer(WithConfig(config), WithClock(clock), WithLogger(log.New(&out, "", 0)))
+	handler := newHTTPHandler(um, nil)
+
+	post := func(responseType string) string {
+		out.Reset()
+		target := upstream.URL + "?type=" + url.QueryEscape(responseType)
+		req := httptest.NewRequest(http.MethodPost, "/proxy?target="+url.QueryEscape(target), strings.NewReader(`{"query":"select"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		// Логирование не должно менять ответ клиенту
+		if rec.Code != http.StatusOK || rec.Body.String() != `{"result":"done"}` {
+			t.Fatalf("proxy returned %d %q", rec.Code, rec.Body)
+		}
+		return out.String()
+	}
+
+	logged := post("application/json")
+	if !strings.Contains(logged, `request body: "{\"query\"" ...(18 bytes total)`) {
+		t.Errorf("request body not truncated to MaxBytes:\n%s", logged)
+	}
+	if !strings.Contains(logged, `response body: "{\"result" ...(17 bytes total)`) {
+		t.Errorf("response body not logged:\n%s", logged)
+	}
+
+	// Лимит - один запрос в секунду
+	if logged := post("application/json"); strings.Contains(logged, "Proxy POST") {
+		t.Errorf("rate limit ignored:\n%s", logged)
+	}
+
+	clock.Advance(time.Second)
+	if logged := post("application/octet-stream"); !strings.Contains(logged, "response body: (not logged)") {
+		t.Errorf("binary response body logged:\n%s", logged)
+	}
+}
+
+func TestProxyBodyLogRequiresDebug(t *testing.T) {
+	config := DefaultConfig()
+	config.ProxyBodyLog = ProxyBodyLogConfig{Enabled: true}
+	if NewUltraMultiplexer(WithConfig(config)).newProxyBodyLogger() != nil {
+		t.Fatal("body logging enabled without DebugEnabled")
+	}
+}
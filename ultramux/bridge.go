@@ -0,0 +1,397 @@
+package ultramux
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	pb "ultramultiplexer/pb/pb"
+)
+
+// methodOverrideHeader позволяет клиентам за прокси, пропускающими только
+// GET и POST, задать фактический HTTP метод запроса. RPC он не выбирает:
+// RPC задается путем /grpc-call/<RPC>
+const methodOverrideHeader = "X-HTTP-Method-Override"
+
+// RPC UltraService, доступные через /grpc-call/<RPC>; /grpc-call без
+// суффикса вызывает SayHello
+const (
+	bridgeSayHello    = "SayHello"
+	bridgeProcessData = "ProcessData"
+)
+
+// grpcTimeoutHeader позволяет клиенту сократить дедлайн вызова, например "2s"
+const grpcTimeoutHeader = "X-Grpc-Timeout"
+
+// bridgeMethods - HTTP методы, которые понимает /grpc-call
+var bridgeMethods = []string{http.MethodGet, http.MethodPost}
+
+// bridgeCallParams - общие параметры маршрутов /grpc-call для документации
+var bridgeCallParams = []RouteParam{
+	{Name: grpcTimeoutHeader, In: "header", Description: "Shorter call deadline, e.g. 2s"},
+	{Name: methodOverrideHeader, In: "header", Description: "Actual HTTP method (GET or POST) for clients limited to POST; does not select the RPC"},
+	{Name: "Accept", In: "header", Description: "application/x-protobuf (or application/protobuf, application/grpc+proto) for a binary protobuf reply instead of JSON"},
+}
+
+var sayHelloParams = append([]RouteParam{
+	{Name: "name", In: "query", Description: "SayHello name"},
+}, bridgeCallParams...)
+
+// protobufMediaTypes - типы в Accept, по которым /grpc-call отдает ответ
+// сериализованным protobuf сообщением вместо JSON
+var protobufMediaTypes = []string{"application/x-protobuf", "application/protobuf", "application/grpc+proto"}
+
+// bridgeProtobufType выбирает формат ответа /grpc-call: тип protobuf из
+// Accept, если его вес выше application/json, иначе "" - JSON. При
+// равенстве весов и для */* остается JSON, чтобы не сломать браузеры
+func bridgeProtobufType(accept string) string {
+	weights := acceptWeights(accept)
+	best, bestQ := "", max(weights.q("application/json"), 0)
+	for _, mediaType := range protobufMediaTypes {
+		if q := weights.q(mediaType); q > bestQ {
+			best, bestQ = mediaType, q
+		}
+	}
+	return best
+}
+
+// effectiveMethod учитывает X-HTTP-Method-Override (только для POST)
+// и проверяет итоговый метод по списку разрешенных
+func effectiveMethod(r *http.Request, allowed []string) (string, error) {
+	method := r.Method
+	if override := r.Header.Get(methodOverrideHeader); override != "" {
+		if r.Method != http.MethodPost {
+			return "", fmt.Errorf("%s is only honored on POST requests", methodOverrideHeader)
+		}
+		method = strings.ToUpper(strings.TrimSpace(override))
+		if !methodAllowed(method, allowed) {
+			return "", fmt.Errorf("unsupported %s value %q, allowed: %s", methodOverrideHeader, override, strings.Join(allowed, ", "))
+		}
+	}
+	return method, nil
+}
+
+// callGRPC возвращает обработчик /grpc-call для RPC rpc
+func (h *HTTPHandler) callGRPC(rpc string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.serveGRPCCall(w, r, rpc)
+	}
+}
+
+func (h *HTTPHandler) serveGRPCCall(w http.ResponseWriter, r *http.Request, rpc string) {
+	if !h.multiplexer.isGRPCClientReady() {
+		h.multiplexer.writeError(w, r, http.StatusServiceUnavailable, "gRPC client not ready")
+		return
+	}
+
+	method, err := effectiveMethod(r, bridgeMethods)
+	if err != nil {
+		h.multiplexer.writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	timeout, err := h.multiplexer.bridgeTimeout(r)
+	if err != nil {
+		h.multiplexer.writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Отключение HTTP клиента отменяет и gRPC вызов; timeout - верхняя граница
+	ctx, cancel := context.WithTimeout(h.multiplexer.forwardCredentials(r.Context()), timeout)
+	defer cancel()
+
+	client := h.multiplexer.currentGRPCClient()
+	if client == nil {
+		h.multiplexer.writeError(w, r, http.StatusServiceUnavailable, "gRPC client not ready")
+		return
+	}
+	var response string
+	var reply proto.Message
+	var header, trailer metadata.MD
+
+	switch rpc {
+	case bridgeSayHello:
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			name = "World"
+		}
+
+		var hello *pb.HelloReply
+		header, trailer, err = h.multiplexer.invokeGRPC(ctx, func(opts ...grpc.CallOption) (err error) {
+			hello, err = client.SayHello(ctx, &pb.HelloRequest{Name: name}, opts...)
+			return err
+		})
+		if err == nil {
+			response, reply = hello.Message, hello
+		}
+
+	case bridgeProcessData:
+		// У GET тела нет: данные только из query
+		data := r.URL.Query().Get("data")
+		if method == http.MethodPost {
+			var dataErr error
+			if data, dataErr = bridgeData(r); dataErr != nil {
+				h.multiplexer.writeError(w, r, http.StatusBadRequest, dataErr.Error())
+				return
+			}
+		}
+
+		var processed *pb.DataReply
+		header, trailer, err = h.multiplexer.invokeGRPC(ctx, func(opts ...grpc.CallOption) (err error) {
+			processed, err = client.ProcessData(ctx, &pb.DataRequest{Data: data}, opts...)
+			return err
+		})
+		if err == nil {
+			response, reply = processed.Processed, processed
+		}
+
+	default:
+		h.multiplexer.writeError(w, r, http.StatusNotFound, "unknown RPC "+rpc)
+		return
+	}
+
+	setGRPCMetadataHeaders(w.Header(), "Grpc-Metadata-", header)
+	setGRPCMetadataHeaders(w.Header(), "Grpc-Trailer-", trailer)
+	w.Header().Add("Vary", "Accept")
+
+	if err != nil {
+		if r.Context().Err() != nil {
+			// Клиент ушел, отвечать некому
+			h.multiplexer.metrics.Inc("bridge_client_canceled_total")
+			return
+		}
+		h.multiplexer.writeGRPCError(w, err)
+		return
+	}
+
+	if contentType := bridgeProtobufType(r.Header.Get("Accept")); contentType != "" {
+		h.multiplexer.writeProtobuf(w, contentType, reply)
+		return
+	}
+
+	h.multiplexer.writeJSON(w, 0, map[string]string{
+		"grpc_response": response,
+	})
+}
+
+// writeProtobuf отдает ответ gRPC как есть, в wire формате protobuf.
+// Ошибки по-прежнему отдаются JSON: у них свой формат (writeGRPCError)
+func (um *UltraMultiplexer) writeProtobuf(w http.ResponseWriter, contentType string, msg proto.Message) {
+	raw, err := proto.Marshal(msg)
+	if err != nil {
+		um.logger.Printf("⚠️ Failed to marshal protobuf response: %v", err)
+		um.writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to encode response"})
+		return
+	}
+	um.metrics.Inc("bridge_protobuf_responses_total")
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Protobuf-Message", string(proto.MessageName(msg)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(raw)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(raw)
+}
+
+// streamGRPC вызывает ProcessDataStream и отдает каждый ответ отдельной
+// строкой NDJSON, сбрасывая буфер после каждой. Ошибка до первого ответа
+// отдается обычным JSON, после - последней строкой {"error": ...}
+func (h *HTTPHandler) streamGRPC(w http.ResponseWriter, r *http.Request) {
+	data, err := bridgeData(r)
+	if err != nil {
+		h.multiplexer.writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	timeout, err := h.multiplexer.bridgeTimeout(r)
+	if err != nil {
+		h.multiplexer.writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	client := h.multiplexer.currentGRPCClient()
+	if client == nil {
+		h.multiplexer.writeError(w, r, http.StatusServiceUnavailable, "gRPC client not ready")
+		return
+	}
+
+	// Отключение HTTP клиента отменяет r.Context(), а с ним и стрим
+	ctx, cancel := context.WithTimeout(h.multiplexer.forwardCredentials(r.Context()), timeout)
+	defer cancel()
+
+	stream, err := client.ProcessDataStream(ctx, &pb.DataRequest{Data: data})
+	if err != nil {
+		h.multiplexer.writeGRPCError(w, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	started := false
+	for {
+		reply, err := stream.Recv()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			if r.Context().Err() != nil {
+				h.multiplexer.metrics.Inc("bridge_client_canceled_total")
+				return
+			}
+			if !started {
+				h.multiplexer.writeGRPCError(w, err)
+				return
+			}
+			st := status.Convert(err)
+			encoder.Encode(map[string]string{"error": st.Message(), "code": st.Code().String()})
+			rc.Flush()
+			return
+		}
+
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if err := encoder.Encode(map[string]string{"processed": reply.Processed}); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			h.multiplexer.logger.Printf("⚠️ NDJSON flush failed: %v", err)
+			return
+		}
+		h.multiplexer.metrics.Inc("bridge_stream_messages_total")
+	}
+}
+
+// bridgeStreamWriteGrace - запас дедлайна записи /grpc-stream сверх
+// BridgeMaxTimeout, чтобы успеть дописать последнюю строку с ошибкой
+const bridgeStreamWriteGrace = 5 * time.Second
+
+func (um *UltraMultiplexer) bridgeMaxTimeout() time.Duration {
+	if um.config.BridgeMaxTimeout <= 0 {
+		return 10 * time.Second
+	}
+	return um.config.BridgeMaxTimeout
+}
+
+// bridgeTimeout возвращает таймаут вызова из X-Grpc-Timeout, не больше BridgeMaxTimeout
+func (um *UltraMultiplexer) bridgeTimeout(r *http.Request) (time.Duration, error) {
+	maxTimeout := um.bridgeMaxTimeout()
+
+	value := r.Header.Get(grpcTimeoutHeader)
+	if value == "" {
+		return maxTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid %s value %q: expected a positive duration like 2s or 500ms", grpcTimeoutHeader, value)
+	}
+	if timeout > maxTimeout {
+		timeout = maxTimeout
+	}
+	return timeout, nil
+}
+
+// invokeGRPC выполняет вызов с ретраями при codes.Unavailable и собирает
+// заголовки и трейлеры ответа
+func (um *UltraMultiplexer) invokeGRPC(ctx context.Context, call func(opts ...grpc.CallOption) error) (header, trailer metadata.MD, err error) {
+	um.withRetries(ctx, um.config.GRPCMaxRetries, func() bool {
+		err = call(grpc.Header(&header), grpc.Trailer(&trailer))
+		return status.Code(err) == codes.Unavailable
+	})
+	return header, trailer, err
+}
+
+// bridgeData берет данные для ProcessData из JSON тела {"data": "..."}
+// или из query параметра data
+func bridgeData(r *http.Request) (string, error) {
+	if r.ContentLength == 0 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return r.URL.Query().Get("data"), nil
+	}
+
+	var body struct {
+		Data string `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid JSON body: %v", err)
+	}
+	return body.Data, nil
+}
+
+// setGRPCMetadataHeaders переносит метаданные gRPC ответа в HTTP заголовки
+// с префиксом. Служебные (grpc-*, content-type) и бинарные (-bin) ключи пропускаются.
+func setGRPCMetadataHeaders(dst http.Header, prefix string, md metadata.MD) {
+	for key, values := range md {
+		if strings.HasPrefix(key, "grpc-") || key == "content-type" || strings.HasSuffix(key, "-bin") {
+			continue
+		}
+		for _, value := range values {
+			dst.Add(prefix+key, value)
+		}
+	}
+}
+
+// httpStatusFromGRPC сопоставляет gRPC код с HTTP статусом (как в grpc-gateway)
+func httpStatusFromGRPC(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // Client Closed Request
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeGRPCError отдает ошибку gRPC вызова в виде JSON с кодом, сообщением и
+// details; HTTP статус выбирается по gRPC коду
+func (um *UltraMultiplexer) writeGRPCError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	httpStatus := httpStatusFromGRPC(st.Code())
+
+	details := make([]json.RawMessage, 0, len(st.Proto().GetDetails()))
+	for _, detail := range st.Proto().GetDetails() {
+		raw, err := protojson.Marshal(detail)
+		if err != nil {
+			continue
+		}
+		details = append(details, raw)
+	}
+
+	um.writeJSON(w, httpStatus, map[string]interface{}{
+		"error":   "gRPC call failed",
+		"code":    st.Code().String(),
+		"message": st.Message(),
+		"details": details,
+	})
+}
@@ -0,0 +1,408 @@
+package ultramux
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	pb "ultramultiplexer/pb/pb"
+)
+
+// fakeUltraClient отвечает на SayHello и ProcessData без сервера
+type fakeUltraClient struct {
+	pb.UltraServiceClient
+}
+
+func (fakeUltraClient) SayHello(_ context.Context, in *pb.HelloRequest, _ ...grpc.CallOption) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: "hello " + in.GetName()}, nil
+}
+
+func (fakeUltraClient) ProcessData(_ context.Context, in *pb.DataRequest, _ ...grpc.CallOption) (*pb.DataReply, error) {
+	return &pb.DataReply{Processed: "processed " + in.GetData()}, nil
+}
+
+func (fakeUltraClient) ProcessDataStream(ctx context.Context, in *pb.DataRequest, _ ...grpc.CallOption) (grpc.ServerStreamingClient[pb.DataReply], error) {
+	return &fakeDataStream{ctx: ctx, data: in.GetData(), left: 3}, nil
+}
+
+// fakeDataStream отдает left ответов с паузой fakeStreamInterval между ними
+type fakeDataStream struct {
+	grpc.ClientStream
+	ctx  context.Context
+	data string
+	left int
+}
+
+const fakeStreamInterval = 300 * time.Millisecond
+
+func (s *fakeDataStream) Recv() (*pb.DataReply, error) {
+	if s.left == 0 {
+		return nil, io.EOF
+	}
+	select {
+	case <-time.After(fakeStreamInterval):
+	case <-s.ctx.Done():
+		return nil, status.FromContextError(s.ctx.Err()).Err()
+	}
+	s.left--
+	return &pb.DataReply{Processed: s.data}, nil
+}
+
+// failingUltraClient отвечает на SayHello ошибкой err
+type failingUltraClient struct {
+	pb.UltraServiceClient
+	err error
+}
+
+func (c failingUltraClient) SayHello(context.Context, *pb.HelloRequest, ...grpc.CallOption) (*pb.HelloReply, error) {
+	return nil, c.err
+}
+
+// metadataUltraClient отдает заголовки и трейлеры через CallOption, как
+// настоящий клиент, и отвечает на SayHello ошибкой err, если она задана
+type metadataUltraClient struct {
+	pb.UltraServiceClient
+	header, trailer metadata.MD
+	err             error
+}
+
+func (c metadataUltraClient) SayHello(_ context.Context, in *pb.HelloRequest, opts ...grpc.CallOption) (*pb.HelloReply, error) {
+	for _, opt := range opts {
+		switch opt := opt.(type) {
+		case grpc.HeaderCallOption:
+			*opt.HeaderAddr = c.header
+		case grpc.TrailerCallOption:
+			*opt.TrailerAddr = c.trailer
+		}
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &pb.HelloReply{Message: "hello " + in.GetName()}, nil
+}
+
+func newBridgeTestHandler(t *testing.T) http.Handler {
+	return newBridgeTestHandlerWithConfig(t, DefaultConfig())
+}
+
+func newBridgeTestHandlerWithConfig(t *testing.T, config Config) http.Handler {
+	t.Helper()
+	um := NewUltraMultiplexer(WithConfig(config))
+	um.grpcClient = fakeUltraClient{}
+	um.serverReady = true
+	return newHTTPHandler(um, nil)
+}
+
+func TestGRPCCallSelectsRPCByPath(t *testing.T) {
+	handler := newBridgeTestHandler(t)
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		override string
+		body     string
+		want     string
+	}{
+		{"default is SayHello", http.MethodGet, "/grpc-call?name=a", "", "", "hello a"},
+		{"plain POST is SayHello", http.MethodPost, "/grpc-call?name=a", "", "", "hello a"},
+		{"SayHello route", http.MethodGet, "/grpc-call/SayHello?name=b", "", "", "hello b"},
+		{"ProcessData GET", http.MethodGet, "/grpc-call/ProcessData?data=x", "", "", "processed x"},
+		{"ProcessData POST body", http.MethodPost, "/grpc-call/ProcessData", "", `{"data":"y"}`, "processed y"},
+		// Override GET: тело игнорируется, как у настоящего GET
+		{"override keeps HTTP meaning", http.MethodPost, "/grpc-call/ProcessData?data=q", "GET", `{"data":"y"}`, "processed q"},
+		{"override POST does not switch RPC", http.MethodPost, "/grpc-call?name=c", "POST", "", "hello c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			if tt.override != "" {
+				req.Header.Set(methodOverrideHeader, tt.override)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+			}
+			var body map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if body["grpc_response"] != tt.want {
+				t.Fatalf("grpc_response = %q, want %q", body["grpc_response"], tt.want)
+			}
+		})
+	}
+}
+
+func TestGRPCCallRejectsBadOverride(t *testing.T) {
+	handler := newBridgeTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/grpc-call", nil)
+	req.Header.Set(methodOverrideHeader, "DELETE")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestGRPCStreamOutlivesServerWriteTimeout(t *testing.T) {
+	config := DefaultConfig()
+	config.BridgeMaxTimeout = 5 * time.Second
+	server := httptest.NewUnstartedServer(newBridgeTestHandlerWithConfig(t, config))
+	// Стрим (3 ответа по 300ms) длиннее WriteTimeout сервера
+	server.Config.WriteTimeout = 500 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/grpc-stream?data=x")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("stream cut off after %q: %v", body, err)
+	}
+	if lines := strings.Count(string(body), "\n"); lines != 3 {
+		t.Fatalf("got %d NDJSON lines, want 3:\n%s", lines, body)
+	}
+}
+
+func TestGRPCCallMapsStatusCodes(t *testing.T) {
+	tests := []struct {
+		code codes.Code
+		want int
+	}{
+		{codes.InvalidArgument, http.StatusBadRequest},
+		{codes.NotFound, http.StatusNotFound},
+		{codes.AlreadyExists, http.StatusConflict},
+		{codes.PermissionDenied, http.StatusForbidden},
+		{codes.Unauthenticated, http.StatusUnauthorized},
+		{codes.ResourceExhausted, http.StatusTooManyRequests},
+		{codes.DeadlineExceeded, http.StatusGatewayTimeout},
+		{codes.Unimplemented, http.StatusNotImplemented},
+		{codes.Internal, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			um := NewUltraMultiplexer()
+			um.grpcClient = failingUltraClient{err: status.Error(tt.code, "boom")}
+			um.serverReady = true
+			handler := newHTTPHandler(um, nil)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/grpc-call?name=a", nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if body["code"] != tt.code.String() || body["message"] != "boom" {
+				t.Fatalf("body = %v", body)
+			}
+		})
+	}
+}
+
+func TestGRPCCallSurfacesMetadataAndDetails(t *testing.T) {
+	st, err := status.New(codes.InvalidArgument, "bad name").WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "name", Description: "too short"}},
+	})
+	if err != nil {
+		t.Fatalf("WithDetails: %v", err)
+	}
+	um := NewUltraMultiplexer()
+	um.grpcClient = metadataUltraClient{
+		header:  metadata.Pairs("x-served-by", "node-1", "grpc-internal", "x", "trace-bin", "raw"),
+		trailer: metadata.Pairs("x-cost", "3"),
+		err:     st.Err(),
+	}
+	um.serverReady = true
+	handler := newHTTPHandler(um, nil)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/grpc-call?name=a", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	if got := rec.Header().Get("Grpc-Metadata-X-Served-By"); got != "node-1" {
+		t.Fatalf("Grpc-Metadata-X-Served-By = %q, want node-1", got)
+	}
+	if got := rec.Header().Get("Grpc-Trailer-X-Cost"); got != "3" {
+		t.Fatalf("Grpc-Trailer-X-Cost = %q, want 3", got)
+	}
+	for _, name := range []string{"Grpc-Metadata-Grpc-Internal", "Grpc-Metadata-Trace-Bin"} {
+		if rec.Header().Get(name) != "" {
+			t.Fatalf("%s must not be exposed", name)
+		}
+	}
+
+	var body struct {
+		Code    string            `json:"code"`
+		Details []json.RawMessage `json:"details"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Code != "InvalidArgument" || len(body.Details) != 1 || !strings.Contains(string(body.Details[0]), "too short") {
+		t.Fatalf("body = %s", rec.Body)
+	}
+}
+
+// deadlineUltraClient отвечает на SayHello оставшимся до дедлайна временем
+type deadlineUltraClient struct {
+	pb.UltraServiceClient
+}
+
+func (deadlineUltraClient) SayHello(ctx context.Context, _ *pb.HelloRequest, _ ...grpc.CallOption) (*pb.HelloReply, error) {
+	deadline, _ := ctx.Deadline()
+	return &pb.HelloReply{Message: time.Until(deadline).Round(time.Second).String()}, nil
+}
+
+func TestGRPCCallTimeoutHeader(t *testing.T) {
+	config := DefaultConfig()
+	config.BridgeMaxTimeout = 5 * time.Second
+	um := NewUltraMultiplexer(WithConfig(config))
+	um.grpcClient = deadlineUltraClient{}
+	um.serverReady = true
+	handler := newHTTPHandler(um, nil)
+
+	tests := []struct {
+		name     string
+		timeout  string
+		want     int
+		wantLeft string
+	}{
+		{"default is the maximum", "", http.StatusOK, "5s"},
+		{"client shortens", "2s", http.StatusOK, "2s"},
+		{"capped at the maximum", "1m", http.StatusOK, "5s"},
+		{"invalid", "soon", http.StatusBadRequest, ""},
+		{"not positive", "-1s", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/grpc-call", nil)
+			if tt.timeout != "" {
+				req.Header.Set(grpcTimeoutHeader, tt.timeout)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var body map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if body["grpc_response"] != tt.wantLeft {
+				t.Fatalf("deadline left = %s, want %s", body["grpc_response"], tt.wantLeft)
+			}
+		})
+	}
+}
+
+func TestBridgeProtobufNegotiation(t *testing.T) {
+	tests := []struct {
+		accept, want string
+	}{
+		{"application/x-protobuf", "application/x-protobuf"},
+		{"application/json;q=0.5, application/protobuf", "application/protobuf"},
+		{"application/grpc+proto;q=0.9, application/x-protobuf", "application/x-protobuf"},
+		{"application/x-protobuf, application/json", ""},
+		{"*/*", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := bridgeProtobufType(tt.accept); got != tt.want {
+			t.Errorf("bridgeProtobufType(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestWriteProtobuf(t *testing.T) {
+	um := NewUltraMultiplexer()
+	msg := wrapperspb.String("hello")
+	rec := httptest.NewRecorder()
+	um.writeProtobuf(rec, "application/x-protobuf", msg)
+
+	if rec.Header().Get("Content-Type") != "application/x-protobuf" || rec.Header().Get("X-Protobuf-Message") != "google.protobuf.StringValue" {
+		t.Fatalf("headers = %v", rec.Header())
+	}
+	var got wrapperspb.StringValue
+	if err := proto.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.GetValue() != "hello" {
+		t.Fatalf("decoded %q, err %v", got.GetValue(), err)
+	}
+}
+
+// blockingUltraClient держит SayHello до отмены контекста и отдает его
+// ошибку в канал canceled
+type blockingUltraClient struct {
+	pb.UltraServiceClient
+	entered  chan struct{}
+	canceled chan error
+}
+
+func (c blockingUltraClient) SayHello(ctx context.Context, _ *pb.HelloRequest, _ ...grpc.CallOption) (*pb.HelloReply, error) {
+	close(c.entered)
+	<-ctx.Done()
+	c.canceled <- ctx.Err()
+	return nil, status.FromContextError(ctx.Err()).Err()
+}
+
+func TestGRPCCallCanceledWithClient(t *testing.T) {
+	client := blockingUltraClient{entered: make(chan struct{}), canceled: make(chan error, 1)}
+	um := NewUltraMultiplexer()
+	um.grpcClient = client
+	um.serverReady = true
+	handler := newHTTPHandler(um, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/grpc-call?name=a", nil).WithContext(ctx))
+	}()
+	<-client.entered
+	cancel()
+
+	select {
+	case err := <-client.canceled:
+		if err != context.Canceled {
+			t.Fatalf("gRPC call ended with %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("gRPC call not canceled after the client left")
+	}
+	<-done
+	if rec.Body.Len() != 0 {
+		t.Errorf("response written to a gone client: %s", rec.Body)
+	}
+	counters, _ := um.metrics.Snapshot()["counters"].(map[string]int64)
+	if counters["bridge_client_canceled_total"] != 1 {
+		t.Errorf("bridge_client_canceled_total = %d, want 1", counters["bridge_client_canceled_total"])
+	}
+}
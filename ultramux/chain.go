@@ -0,0 +1,129 @@
+package ultramux
+
+import (
+	"sort"
+
+	"google.golang.org/grpc"
+)
+
+// InterceptorStage задает позицию интерсептора в цепочке gRPC. Стадии
+// выполняются снаружи внутрь в порядке объявления:
+//
+//	Recovery      - перехват паник; самый внешний, чтобы паника превращалась
+//	                в codes.Internal до того, как ее увидят остальные стадии
+//	Observability - логирование, латентность, метрики; видят и отказы
+//	                последующих стадий, и запросы с паникой (учет идет в
+//	                defer, паника записывается как codes.Internal)
+//	Auth          - аутентификация и авторизация
+//	Limits        - лимиты и rate limiting; после Auth, чтобы знать клиента
+//	Handler       - самые внутренние, непосредственно перед обработчиком
+//
+// Внутри одной стадии встроенные интерсепторы идут первыми, затем
+// пользовательские в порядке регистрации.
+type InterceptorStage int
+
+const (
+	StageRecovery InterceptorStage = iota
+	StageObservability
+	StageAuth
+	StageLimits
+	StageHandler
+)
+
+type stagedUnaryInterceptor struct {
+	stage       InterceptorStage
+	interceptor grpc.UnaryServerInterceptor
+}
+
+type stagedStreamInterceptor struct {
+	stage       InterceptorStage
+	interceptor grpc.StreamServerInterceptor
+}
+
+// UseUnaryInterceptor добавляет unary интерсептор в стадию stage.
+// Должен вызываться до Initialize.
+func (um *UltraMultiplexer) UseUnaryInterceptor(stage InterceptorStage, interceptor grpc.UnaryServerInterceptor) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.unaryInterceptors = append(um.unaryInterceptors, stagedUnaryInterceptor{stage, interceptor})
+}
+
+// UseStreamInterceptor добавляет stream интерсептор в стадию stage.
+// Должен вызываться до Initialize.
+func (um *UltraMultiplexer) UseStreamInterceptor(stage InterceptorStage, interceptor grpc.StreamServerInterceptor) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.streamInterceptors = append(um.streamInterceptors, stagedStreamInterceptor{stage, interceptor})
+}
+
+func (um *UltraMultiplexer) builtinUnaryInterceptors() []stagedUnaryInterceptor {
+	builtin := []stagedUnaryInterceptor{
+		{StageRecovery, um.recoveryUnaryInterceptor},
+		{StageObservability, um.latencyUnaryInterceptor},
+		{StageLimits, um.clientLimitUnaryInterceptor},
+	}
+	if um.authenticator != nil || um.tenantAuthEnabled() {
+		builtin = append(builtin, stagedUnaryInterceptor{StageAuth, um.authUnaryInterceptor})
+	}
+	if um.methodLimiter != nil {
+		builtin = append(builtin, stagedUnaryInterceptor{StageLimits, um.methodRateLimitUnaryInterceptor})
+	}
+	if um.config.GRPCMessageSize.enabled() {
+		builtin = append(builtin, stagedUnaryInterceptor{StageLimits, um.messageSizeUnaryInterceptor})
+	}
+	if um.handlerPool != nil {
+		builtin = append(builtin, stagedUnaryInterceptor{StageLimits, um.workerPoolUnaryInterceptor})
+	}
+	if um.chaosEnabled() {
+		builtin = append(builtin, stagedUnaryInterceptor{StageHandler, um.chaosUnaryInterceptor})
+	}
+	return builtin
+}
+
+func (um *UltraMultiplexer) builtinStreamInterceptors() []stagedStreamInterceptor {
+	builtin := []stagedStreamInterceptor{
+		{StageRecovery, um.recoveryStreamInterceptor},
+		{StageObservability, um.latencyStreamInterceptor},
+		{StageLimits, um.clientLimitStreamInterceptor},
+	}
+	if um.authenticator != nil || um.tenantAuthEnabled() {
+		builtin = append(builtin, stagedStreamInterceptor{StageAuth, um.authStreamInterceptor})
+	}
+	if um.methodLimiter != nil {
+		builtin = append(builtin, stagedStreamInterceptor{StageLimits, um.methodRateLimitStreamInterceptor})
+	}
+	if um.config.GRPCMessageSize.enabled() {
+		builtin = append(builtin, stagedStreamInterceptor{StageLimits, um.messageSizeStreamInterceptor})
+	}
+	if um.handlerPool != nil {
+		builtin = append(builtin, stagedStreamInterceptor{StageLimits, um.workerPoolStreamInterceptor})
+	}
+	if um.chaosEnabled() {
+		builtin = append(builtin, stagedStreamInterceptor{StageHandler, um.chaosStreamInterceptor})
+	}
+	return builtin
+}
+
+// unaryChain собирает цепочку для grpc.ChainUnaryInterceptor
+func (um *UltraMultiplexer) unaryChain() []grpc.UnaryServerInterceptor {
+	staged := append(um.builtinUnaryInterceptors(), um.unaryInterceptors...)
+	sort.SliceStable(staged, func(i, j int) bool { return staged[i].stage < staged[j].stage })
+
+	chain := make([]grpc.UnaryServerInterceptor, len(staged))
+	for i, s := range staged {
+		chain[i] = s.interceptor
+	}
+	return chain
+}
+
+// streamChain собирает цепочку для grpc.ChainStreamInterceptor
+func (um *UltraMultiplexer) streamChain() []grpc.StreamServerInterceptor {
+	staged := append(um.builtinStreamInterceptors(), um.streamInterceptors...)
+	sort.SliceStable(staged, func(i, j int) bool { return staged[i].stage < staged[j].stage })
+
+	chain := make([]grpc.StreamServerInterceptor, len(staged))
+	for i, s := range staged {
+		chain[i] = s.interceptor
+	}
+	return chain
+}
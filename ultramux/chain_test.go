@@ -0,0 +1,69 @@
+package ultramux
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestInterceptorStagesOrder(t *testing.T) {
+	um := newTestMultiplexer(t, DefaultConfig())
+	um.RegisterGRPCService(registerPingService)
+
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return handler(ctx, req)
+		}
+	}
+	// Регистрируем в обратном порядке: цепочка должна следовать стадиям
+	um.UseUnaryInterceptor(StageHandler, record("handler"))
+	um.UseUnaryInterceptor(StageAuth, record("auth"))
+	um.UseUnaryInterceptor(StageObservability, record("observability-1"))
+	um.UseUnaryInterceptor(StageObservability, record("observability-2"))
+	um.UseUnaryInterceptor(StageHandler, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		panic("boom")
+	})
+	startTestMultiplexer(t, um)
+
+	conn, err := grpc.NewClient(um.config.Listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Паника внутренней стадии перехватывается Recovery
+	err = conn.Invoke(ctx, "/ultramux.test.Ping/Ping", &emptypb.Empty{}, &emptypb.Empty{})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("call error = %v, want Internal", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"observability-1", "observability-2", "auth", "handler"}
+	if len(order) != len(want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+	counters, _ := um.metrics.Snapshot()["counters"].(map[string]int64)
+	if counters["grpc_panics_total"] != 1 {
+		t.Fatalf("grpc_panics_total = %d, want 1", counters["grpc_panics_total"])
+	}
+}
@@ -0,0 +1,138 @@
+package ultramux
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ChaosConfig - внедрение отказов для проверки ретраев и таймаутов клиентов.
+// Работает только при DebugEnabled.
+type ChaosConfig struct {
+	Rules []ChaosRule
+}
+
+// ChaosRule срабатывает с вероятностью Probability для запросов к Path.
+// Сначала выдерживается Delay, затем, если задано, соединение рвется
+// (DropConnection) или возвращается ошибка (HTTPStatus / GRPCCode).
+type ChaosRule struct {
+	// Path - HTTP путь или полное имя gRPC метода ("/pkg.Service/Method");
+	// пустой Path применяется ко всем запросам, кроме health и readiness
+	// проверок (иначе хаос мешал бы Start дождаться готовности) - их
+	// можно задеть только правилом, явно называющим путь
+	Path        string
+	Probability float64
+	Delay       time.Duration
+	HTTPStatus  int
+	GRPCCode    codes.Code
+	// DropConnection закрывает HTTP соединение без ответа; для gRPC
+	// вызов завершается с codes.Unavailable
+	DropConnection bool
+}
+
+func (um *UltraMultiplexer) chaosEnabled() bool {
+	return um.config.DebugEnabled && len(um.config.Chaos.Rules) > 0
+}
+
+// chaosRuleFor выбирает первое подходящее правило и бросает кубик
+func (um *UltraMultiplexer) chaosRuleFor(path string) *ChaosRule {
+	for i := range um.config.Chaos.Rules {
+		rule := &um.config.Chaos.Rules[i]
+		if rule.Path == "" && chaosExempt(path) {
+			continue
+		}
+		if rule.Path != "" && rule.Path != path {
+			continue
+		}
+		if rand.Float64() >= rule.Probability {
+			return nil
+		}
+		um.metrics.Inc("chaos_injected_total")
+		return rule
+	}
+	return nil
+}
+
+// chaosExempt - пути проверок готовности: /health опрашивает Start,
+// /readyz и gRPC health - балансировщики
+func chaosExempt(path string) bool {
+	return path == "/health" || path == "/readyz" || strings.HasPrefix(path, "/grpc.health.v1.")
+}
+
+// chaosDelay ждет rule.Delay; false, если запрос отменили раньше
+func (um *UltraMultiplexer) chaosDelay(ctx context.Context, rule *ChaosRule) bool {
+	if rule.Delay <= 0 {
+		return true
+	}
+	select {
+	case <-um.clock.After(rule.Delay):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (um *UltraMultiplexer) chaosMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule := um.chaosRuleFor(r.URL.Path)
+		if rule == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		um.logger.Printf("🐛 Chaos: injecting failure into %s %s", r.Method, r.URL.Path)
+		if !um.chaosDelay(r.Context(), rule) {
+			return
+		}
+		switch {
+		case rule.DropConnection:
+			// net/http закрывает соединение без ответа и не логирует панику
+			panic(http.ErrAbortHandler)
+		case rule.HTTPStatus != 0:
+			um.writeError(w, r, rule.HTTPStatus, "chaos: injected failure")
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// chaosError возвращает ошибку для gRPC вызова или nil, если вызов надо пропустить
+func (um *UltraMultiplexer) chaosError(ctx context.Context, method string) error {
+	rule := um.chaosRuleFor(method)
+	if rule == nil {
+		return nil
+	}
+
+	um.logger.Printf("🐛 Chaos: injecting failure into %s", method)
+	if !um.chaosDelay(ctx, rule) {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	switch {
+	case rule.DropConnection:
+		return status.Error(codes.Unavailable, "chaos: connection dropped")
+	case rule.GRPCCode != codes.OK:
+		return status.Error(rule.GRPCCode, "chaos: injected failure")
+	default:
+		return nil
+	}
+}
+
+func (um *UltraMultiplexer) chaosUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := um.chaosError(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (um *UltraMultiplexer) chaosStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := um.chaosError(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
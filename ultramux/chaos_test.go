@@ -0,0 +1,24 @@
+package ultramux
+
+import "testing"
+
+func TestChaosCatchAllSkipsHealthChecks(t *testing.T) {
+	config := DefaultConfig()
+	config.DebugEnabled = true
+	config.Chaos.Rules = []ChaosRule{{Probability: 1, HTTPStatus: 503}}
+	um := NewUltraMultiplexer(WithConfig(config))
+
+	for _, path := range []string{"/health", "/readyz", "/grpc.health.v1.Health/Check"} {
+		if rule := um.chaosRuleFor(path); rule != nil {
+			t.Errorf("catch-all rule applied to %s", path)
+		}
+	}
+	if um.chaosRuleFor("/echo") == nil {
+		t.Error("catch-all rule did not apply to /echo")
+	}
+
+	um.config.Chaos.Rules = []ChaosRule{{Path: "/health", Probability: 1, HTTPStatus: 503}}
+	if um.chaosRuleFor("/health") == nil {
+		t.Error("explicit /health rule did not apply")
+	}
+}
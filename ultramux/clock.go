@@ -0,0 +1,17 @@
+package ultramux
+
+import "time"
+
+// Clock абстрагирует время, чтобы таймауты, опрос готовности и кэши можно
+// было тестировать с фейковыми часами без реальных задержек
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
@@ -0,0 +1,254 @@
+package ultramux
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Config содержит настраиваемые параметры мультиплексора
+type Config struct {
+	// HTTPClient используется /proxy для запросов в upstream. Если не задан,
+	// создается клиент с таймаутом ожидания заголовков ответа 10 секунд
+	HTTPClient *http.Client
+	// Clock - источник времени; по умолчанию системные часы
+	Clock Clock
+	// Logger - куда мультиплексор пишет свои логи; nil - стандартный log
+	Logger *log.Logger
+	// ProxyAllowedMethods - методы, которые /proxy пересылает в upstream.
+	// Пустой список - только GET и HEAD; методы с телом (POST, PUT...)
+	// нужно разрешить явно
+	ProxyAllowedMethods []string
+	// ProxyDefaultTarget - абсолютный http(s) URL upstream'а для запросов
+	// /proxy без параметра target; пустой - target обязателен
+	ProxyDefaultTarget string
+	// ProxyTargets - настройки /proxy для отдельных upstream
+	ProxyTargets []ProxyTarget
+	// ProxyRedirects - политика следования редиректам по умолчанию
+	ProxyRedirects RedirectPolicy
+	// ProxyMaxResponseBytes ограничивает размер тела ответа upstream. Если
+	// длина заранее неизвестна и лимит превышен на ходу, соединение с
+	// клиентом обрывается. 0 - без лимита
+	ProxyMaxResponseBytes int64
+	// ProxyAllowedContentTypes - разрешенные Content-Type ответов upstream
+	// ("application/json", "text/*"); остальные отклоняются с 502. Пустой - без проверки
+	ProxyAllowedContentTypes []string
+	// ProxyUserAgent - User-Agent исходящих запросов /proxy; пустой - Go по умолчанию
+	ProxyUserAgent string
+	// ProxyVia - имя мультиплексора в заголовке Via; пустой - Via не добавляется
+	ProxyVia string
+	// ProxyWriteTimeout - дедлайн записи ответа /proxy вместо общего
+	// WriteTimeout сервера (30s); <0 - без дедлайна для больших загрузок.
+	// Клиент по умолчанию ограничивает только ожидание заголовков (10s);
+	// у своего HTTPClient с Timeout чтение тела ограничено и им
+	ProxyWriteTimeout time.Duration
+	// ProxyCache - кэш GET ответов /proxy с условными запросами
+	// (ETag/If-None-Match, Last-Modified), по умолчанию выключен
+	ProxyCache ProxyCacheConfig
+	// ProxyDNSCache - кэш DNS для upstream'ов /proxy, по умолчанию выключен
+	ProxyDNSCache DNSCacheConfig
+	// ProxyBufferThreshold - ответы upstream без Content-Length (chunked) до
+	// этого размера буферизуются и отдаются с Content-Length; большие
+	// стримятся как раньше. Потоковые типы (text/event-stream, NDJSON)
+	// не буферизуются. 0 - всегда стримить
+	ProxyBufferThreshold int
+	// ProxyMaxConcurrent ограничивает число одновременных запросов /proxy;
+	// сверх лимита - 503 с Retry-After. 0 - без ограничений
+	ProxyMaxConcurrent int
+	// ProxyMaxRetries - число повторов идемпотентных запросов /proxy при
+	// сетевых ошибках и ответах 502/503/504. 0 - без повторов
+	ProxyMaxRetries int
+	// FanOutConcurrency - максимум одновременных запросов в FanOutGET
+	// (0 - все сразу)
+	FanOutConcurrency int
+	// FanOutTimeout - общий дедлайн FanOutGET
+	FanOutTimeout time.Duration
+	// UpstreamDeadlineMargin вычитается из оставшегося gRPC дедлайна в
+	// UpstreamContext, чтобы успеть ответить клиенту после HTTP вызова
+	UpstreamDeadlineMargin time.Duration
+	// BridgeMaxTimeout - максимальный дедлайн вызова через /grpc-call и
+	// /grpc-stream; клиент может сократить его заголовком X-Grpc-Timeout.
+	// Дедлайн записи /grpc-stream - BridgeMaxTimeout плюс 5s
+	BridgeMaxTimeout time.Duration
+	// GatewayServices - полные имена gRPC сервисов, доступных через
+	// /gateway. nil - сервисы, зарегистрированные на gRPC сервере, кроме
+	// служебных grpc.* (health, reflection). DebugService недоступен никогда
+	GatewayServices []string
+	// GRPCMaxRetries - число повторов вызова /grpc-call при codes.Unavailable
+	GRPCMaxRetries int
+	// RetryBudget ограничивает долю ретраев при массовых отказах
+	RetryBudget RetryBudgetConfig
+	// RetryJitter - рандомизация задержек ретраев (none, full, equal);
+	// опрос готовности при старте не рандомизируется
+	RetryJitter JitterStrategy
+
+	// Listener - готовый listener вместо net.Listen на порту (например,
+	// bufconn в тестах). Мультиплексор закрывает его при остановке
+	Listener net.Listener
+	// ListenFD - номер уже открытого дескриптора сокета (socket activation);
+	// используется, если Listener не задан. 0 - открыть порт самим
+	ListenFD int
+	// Dialer используется самоподключениями (проверки готовности, внутренний
+	// gRPC клиент) вместо TCP к localhost. Для bufconn:
+	//   func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }
+	Dialer func(ctx context.Context, addr string) (net.Conn, error)
+
+	// PortRetries - сколько следующих портов попробовать, если порт занят
+	// (удобно при локальной разработке). 0 - сразу вернуть ErrPortInUse
+	PortRetries int
+	// ListenBacklog - длина очереди принятых ядром соединений. 0 - системная
+	// (net.core.somaxconn). Поддерживается только на Linux
+	ListenBacklog int
+	// ReusePort включает SO_REUSEPORT, чтобы несколько процессов делили порт
+	// и accept масштабировался по ядрам. Поддерживается только на Linux
+	ReusePort bool
+	// DisableTCPNoDelay снимает TCP_NODELAY с принятых соединений: пакетов
+	// меньше, но с delayed ACK клиента мелкий ответ, записанный в несколько
+	// приемов, ждет десятки миллисекунд (см. BenchmarkTCPTuning). Для RPC
+	// с малыми сообщениями не включать
+	DisableTCPNoDelay bool
+	// TCPReadBuffer и TCPWriteBuffer - SO_RCVBUF / SO_SNDBUF принятых
+	// соединений в байтах. 0 - автонастройка ядра, которую явное значение
+	// отключает; задавать стоит под измеренный bandwidth-delay product
+	TCPReadBuffer  int
+	TCPWriteBuffer int
+
+	// TLS включает TLS на общем порту; nil - открытый текст
+	TLS *TLSConfig
+
+	// HTTP3 включает HTTP/3 (QUIC) на UDP; нужен TLS
+	HTTP3 *HTTP3Config
+	// DebugEnabled включает отладочные возможности (gRPC DebugService).
+	// Не включайте в production
+	DebugEnabled bool
+
+	// Chaos - внедрение задержек и отказов (нужен DebugEnabled)
+	Chaos ChaosConfig
+	// ProxyBodyLog - отладочное логирование тел /proxy (нужен DebugEnabled)
+	ProxyBodyLog ProxyBodyLogConfig
+	// RequestLogSize - сколько последних запросов хранить для /admin/requests
+	// (0 - не хранить)
+	RequestLogSize int
+	// DisabledEndpoints - пути эндпоинтов, выключенных при старте;
+	// переключаются через /admin/flags
+	DisabledEndpoints []string
+	// AuthSkipPaths - HTTP пути, доступные без аутентификации при
+	// установленном SetAuthenticator (пробы балансировщика)
+	AuthSkipPaths []string
+	// AccessRules - упорядоченные правила доступа к HTTP эндпоинтам по
+	// методу, пути и ролям Identity; проверяются после аутентификации
+	AccessRules []AccessRule
+	// AdminToken включает /admin/* эндпоинты; запросы должны нести
+	// Authorization: Bearer <AdminToken>
+	AdminToken string
+	// HTMLErrorPages включает HTML страницы ошибок для клиентов, чей Accept
+	// предпочитает text/html; остальные по-прежнему получают JSON
+	HTMLErrorPages bool
+	// ErrorPageTemplate - html/template страницы ошибки с полями Status,
+	// StatusText, Message и RequestID; пустой - встроенный шаблон
+	ErrorPageTemplate string
+	// GRPCRateLimits - rate limiting gRPC вызовов по методам
+	GRPCRateLimits MethodRateLimitConfig
+	// GRPCMessageSize - лимиты размера gRPC сообщений по методам
+	GRPCMessageSize MessageSizeConfig
+	// KV - хранилище ключ-значение RPC Set/Get/Delete
+	KV KVConfig
+	// Favicon - содержимое /favicon.ico (ICO, PNG или SVG). Пустой - 404 без
+	// тела, чтобы браузеры не получали JSON корневого обработчика
+	Favicon []byte
+	// JSON - отступы и экранирование HTML в JSON ответах
+	JSON JSONConfig
+
+	// Health - дополнительные поля и код ответа /health при дренаже
+	Health HealthResponseConfig
+	// AccessLog включает логирование каждого HTTP запроса и gRPC вызова
+	AccessLog bool
+	// HeartbeatInterval - период строки "💓 Heartbeat" в логе со сводкой
+	// аптайма, запросов и соединений. 0 - выключено
+	HeartbeatInterval time.Duration
+	// AccessLogHeaders - заголовки HTTP (и одноименные ключи метаданных gRPC),
+	// которые пишутся в access-лог и /admin/requests
+	AccessLogHeaders []string
+	// LogRedactKeys - заголовки и ключи метаданных, значения которых в логах
+	// заменяются на [REDACTED]: access-лог, /admin/requests, лог тел /proxy
+	LogRedactKeys []string
+	// SlowRequestThreshold: если задан, логируются только запросы дольше порога
+	SlowRequestThreshold time.Duration
+	// MaxInFlightPerClient ограничивает число одновременных запросов от одного
+	// клиента (по API ключу или IP). 0 - без ограничений
+	MaxInFlightPerClient int
+
+	// UpstreamDependencies проверяются в /readyz
+	UpstreamDependencies []UpstreamDependency
+	// UpstreamHealthCacheTTL - время жизни результата проверки зависимости
+	UpstreamHealthCacheTTL time.Duration
+
+	// CmuxMatchSlowThreshold: соединения, протокол которых определялся
+	// дольше порога, логируются. Гистограмма cmux_match_latency пишется всегда
+	CmuxMatchSlowThreshold time.Duration
+
+	// ConnIdleTimeout - жесткий лимит простоя любого принятого соединения
+	// (HTTP и gRPC). gRPC keepalive пинги считаются активностью: живой клиент,
+	// отвечающий на пинги, не отключается, а оборванные соединения закрываются.
+	// Для gRPC также выставляется MaxConnectionIdle, чтобы простаивающие
+	// соединения сначала закрывались штатно через GOAWAY. 0 - без лимита
+	ConnIdleTimeout time.Duration
+	// GRPCMaxConnectionAge - после этого срока gRPC соединение закрывается
+	// через GOAWAY, и клиенты переподключаются (перебалансировка, новые
+	// записи DNS). К сроку добавляется случайный разброс +-10%. 0 - без лимита
+	GRPCMaxConnectionAge time.Duration
+	// GRPCMaxConnectionAgeGrace - сколько ждать завершения активных вызовов
+	// после GOAWAY по возрасту; 0 - без ограничения
+	GRPCMaxConnectionAgeGrace time.Duration
+
+	// AutoTuneCPU определяет эффективное число CPU по квоте cgroup и
+	// использует его как число gRPC воркеров. GOMAXPROCS не меняется, при
+	// превышении квоты пишется рекомендация в лог
+	AutoTuneCPU bool
+	// GRPCStreamWorkers задает grpc.NumStreamWorkers явно (приоритетнее
+	// AutoTuneCPU). 0 - поведение gRPC по умолчанию, горутина на стрим
+	GRPCStreamWorkers int
+
+	// GRPCWorkerPool ограничивает одновременно выполняемые gRPC обработчики
+	// с очередью; Size 0 - без ограничения
+	GRPCWorkerPool WorkerPoolConfig
+	// PreShutdownDelay - пауза в начале Shutdown: /readyz уже отвечает
+	// not ready, но запросы продолжают обслуживаться, пока балансировщик
+	// (например, Kubernetes Service) не уберет инстанс из эндпоинтов
+	PreShutdownDelay time.Duration
+
+	// ReadinessPollInterval - пауза между проверками готовности HTTP и gRPC
+	// при старте; 0 - 1s
+	ReadinessPollInterval time.Duration
+	// StartupTimeout - общий бюджет ожидания готовности при старте, не
+	// зависящий от частоты опроса; 0 - 20s. По истечении Start возвращает
+	// ErrServersNotReady с указанием, какой сервер не ответил
+	StartupTimeout time.Duration
+	// ShutdownTimeout ограничивает дренаж HTTP сервера при Shutdown
+	ShutdownTimeout time.Duration
+	// GRPCDrainTimeout ограничивает GracefulStop gRPC сервера; по истечении
+	// вызывается Stop, обрывающий незавершенные стримы
+	GRPCDrainTimeout time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		UpstreamHealthCacheTTL: 5 * time.Second,
+		BridgeMaxTimeout:       10 * time.Second,
+		RetryJitter:            JitterFull,
+		RequestLogSize:         200,
+		LogRedactKeys:          []string{"Authorization", "Cookie", "Set-Cookie", "X-API-Key"},
+		AuthSkipPaths:          []string{"/health", "/readyz"},
+		FanOutConcurrency:      4,
+		FanOutTimeout:          10 * time.Second,
+		ProxyWriteTimeout:      10 * time.Minute,
+		ProxyUserAgent:         "ultra-multiplexer/" + Version,
+		ProxyVia:               "ultra-multiplexer",
+		ReadinessPollInterval:  1 * time.Second,
+		StartupTimeout:         20 * time.Second,
+		ShutdownTimeout:        15 * time.Second,
+		GRPCDrainTimeout:       10 * time.Second,
+	}
+}
@@ -0,0 +1,310 @@
+package ultramux
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/soheilhy/cmux"
+)
+
+// idleTimeoutListener закрывает принятые соединения, по которым не было
+// ни одного байта в течение timeout
+type idleTimeoutListener struct {
+	net.Listener
+	timeout time.Duration
+	metrics *Metrics
+	logger  *log.Logger
+}
+
+func (l *idleTimeoutListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return newIdleConn(conn, l.timeout, l.metrics, l.logger), nil
+}
+
+// idleConn не трогает read/write дедлайны (их выставляют сами HTTP и gRPC
+// серверы), а следит за активностью таймером
+type idleConn struct {
+	net.Conn
+	timeout      time.Duration
+	metrics      *Metrics
+	logger       *log.Logger
+	lastActivity int64
+	timer        *time.Timer
+}
+
+func newIdleConn(conn net.Conn, timeout time.Duration, metrics *Metrics, logger *log.Logger) *idleConn {
+	c := &idleConn{
+		Conn:    conn,
+		timeout: timeout,
+		metrics: metrics,
+		logger:  logger,
+	}
+	c.touch()
+	// Таймер создается остановленным и запускается после присваивания:
+	// иначе checkIdle мог бы сработать раньше и вызвать Reset у nil
+	c.timer = time.AfterFunc(time.Hour, c.checkIdle)
+	c.timer.Stop()
+	c.timer.Reset(timeout)
+	return c
+}
+
+func (c *idleConn) touch() {
+	atomic.StoreInt64(&c.lastActivity, time.Now().UnixNano())
+}
+
+func (c *idleConn) checkIdle() {
+	idle := time.Since(time.Unix(0, atomic.LoadInt64(&c.lastActivity)))
+	if idle < c.timeout {
+		c.timer.Reset(c.timeout - idle)
+		return
+	}
+
+	c.logger.Printf("⏱️ Closing idle connection from %s (idle %v)", c.RemoteAddr(), idle.Round(time.Second))
+	c.metrics.Inc("connections_idle_closed_total")
+	c.Conn.Close()
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.touch()
+	}
+	return n, err
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.touch()
+	}
+	return n, err
+}
+
+func (c *idleConn) Close() error {
+	c.timer.Stop()
+	return c.Conn.Close()
+}
+
+// acceptTimingListener запоминает момент accept каждого соединения,
+// чтобы измерить время до определения протокола в cmux, и считает байты
+// соединения
+type acceptTimingListener struct {
+	net.Listener
+	clock   Clock
+	metrics *Metrics
+	open    *atomic.Int64 // открытые соединения для gauge connections_open
+}
+
+func (l *acceptTimingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	l.open.Add(1)
+	return &timedConn{Conn: conn, acceptedAt: l.clock.Now(), metrics: l.metrics, open: l.open}, nil
+}
+
+// timedConn считает прочитанные и записанные байты в счетчики
+// bytes_in_<proto>_total / bytes_out_<proto>_total. Протокол известен только
+// после матчинга cmux, поэтому байты до него копятся в pending и
+// переносятся в setProtocol (или в unmatched при закрытии).
+type timedConn struct {
+	net.Conn
+	acceptedAt time.Time
+	metrics    *Metrics
+	open       *atomic.Int64
+
+	bytesIn, bytesOut     atomic.Pointer[int64]
+	pendingIn, pendingOut atomic.Int64
+	closeOnce             sync.Once
+}
+
+func (c *timedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.count(&c.bytesIn, &c.pendingIn, n)
+	return n, err
+}
+
+func (c *timedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.count(&c.bytesOut, &c.pendingOut, n)
+	return n, err
+}
+
+func (c *timedConn) count(counter *atomic.Pointer[int64], pending *atomic.Int64, n int) {
+	if n <= 0 {
+		return
+	}
+	if p := counter.Load(); p != nil {
+		atomic.AddInt64(p, int64(n))
+		return
+	}
+	pending.Add(int64(n))
+}
+
+func (c *timedConn) setProtocol(protocol string) {
+	c.bytesIn.Store(c.metrics.counter("bytes_in_" + protocol + "_total"))
+	c.bytesOut.Store(c.metrics.counter("bytes_out_" + protocol + "_total"))
+	c.flushPending()
+}
+
+func (c *timedConn) flushPending() {
+	if in := c.pendingIn.Swap(0); in > 0 {
+		atomic.AddInt64(c.bytesIn.Load(), in)
+	}
+	if out := c.pendingOut.Swap(0); out > 0 {
+		atomic.AddInt64(c.bytesOut.Load(), out)
+	}
+}
+
+func (c *timedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.open.Add(-1)
+		if c.bytesIn.Load() == nil {
+			c.setProtocol("unmatched")
+		} else {
+			c.flushPending()
+		}
+	})
+	return c.Conn.Close()
+}
+
+func (c *timedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// acceptErrorListener запоминает первую фатальную ошибку Accept корневого
+// listener'а. cmux.Serve возвращает ее только после матчинга уже принятых
+// соединений, а соединение клиента моста без запросов остается в матчинге
+// до первого RPC: без этого Start не заметил бы, что порт умер
+type acceptErrorListener struct {
+	net.Listener
+	once   sync.Once
+	failed chan struct{}
+	err    error
+}
+
+func (l *acceptErrorListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		// Как в cmux: продолжает он только на временных ошибках
+		if ne, ok := err.(net.Error); !ok || !ne.Temporary() {
+			l.once.Do(func() {
+				l.err = err
+				close(l.failed)
+			})
+		}
+	}
+	return conn, err
+}
+
+// protocolListener оборачивает под-listener cmux и учитывает соединения,
+// сопоставленные с протоколом: счетчик cmux_connections_<proto>_total и
+// латентность матчинга
+type protocolListener struct {
+	net.Listener
+	protocol string
+	um       *UltraMultiplexer
+}
+
+func (l *protocolListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		l.um.metrics.Inc("cmux_connections_" + l.protocol + "_total")
+		if mc, ok := conn.(*cmux.MuxConn); ok {
+			if tc, ok := mc.Conn.(*timedConn); ok {
+				tc.setProtocol(l.protocol)
+				l.um.observeMatchLatency(l.protocol, mc.RemoteAddr(), l.um.clock.Now().Sub(tc.acceptedAt))
+			}
+		}
+		// Под TLS handshake к этому моменту завершен: cmux уже прочитал
+		// расшифрованные байты
+		if !l.um.checkALPN(l.protocol, conn) {
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+// rejectTLSConns закрывает TLS соединения, пришедшие на порт без TLS:
+// клиент настроен на https://, а сервер - нет
+func (um *UltraMultiplexer) rejectTLSConns(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		um.logger.Printf("⚠️ TLS ClientHello from %s on plaintext port %s: client expects HTTPS/TLS, but TLS is not configured; closing",
+			conn.RemoteAddr(), um.port)
+		um.metrics.Inc("tls_on_plaintext_rejected_total")
+		conn.Close()
+	}
+}
+
+// handleMuxError учитывает соединения, которые не подошли ни одному матчеру
+// (в том числе из-за ошибки чтения при матчинге); cmux их закрывает.
+// Остальные ошибки cmux обрабатывает сам: продолжает только на временных.
+func (um *UltraMultiplexer) handleMuxError(err error) bool {
+	var notMatched cmux.ErrNotMatched
+	if errors.As(err, &notMatched) {
+		um.metrics.Inc("cmux_connections_unmatched_total")
+	}
+	return true
+}
+
+func (um *UltraMultiplexer) observeMatchLatency(protocol string, remote net.Addr, latency time.Duration) {
+	um.metrics.Observe("cmux_match_latency", latency)
+	um.metrics.Observe("cmux_match_latency_"+protocol, latency)
+
+	if threshold := um.config.CmuxMatchSlowThreshold; threshold > 0 && latency > threshold {
+		um.logger.Printf("⚠️ Slow cmux protocol match: %s connection from %s matched after %v (threshold %v)", protocol, remote, latency, threshold)
+	}
+}
+
+// tcpTuningListener применяет Config.DisableTCPNoDelay и размеры буферов
+// сокета к каждому принятому TCP соединению, до матчинга cmux: так опции
+// действуют и на HTTP, и на gRPC
+type tcpTuningListener struct {
+	net.Listener
+	noDelay     bool
+	readBuffer  int
+	writeBuffer int
+	logger      *log.Logger
+}
+
+func (l *tcpTuningListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return conn, nil
+	}
+	if err := tcp.SetNoDelay(l.noDelay); err != nil {
+		l.logger.Printf("⚠️ Failed to set TCP_NODELAY=%v for %s: %v", l.noDelay, conn.RemoteAddr(), err)
+	}
+	if l.readBuffer > 0 {
+		if err := tcp.SetReadBuffer(l.readBuffer); err != nil {
+			l.logger.Printf("⚠️ Failed to set SO_RCVBUF for %s: %v", conn.RemoteAddr(), err)
+		}
+	}
+	if l.writeBuffer > 0 {
+		if err := tcp.SetWriteBuffer(l.writeBuffer); err != nil {
+			l.logger.Printf("⚠️ Failed to set SO_SNDBUF for %s: %v", conn.RemoteAddr(), err)
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,245 @@
+package ultramux
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/soheilhy/cmux"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestIdleConnImmediateTimeout(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	for i := 0; i < 100; i++ {
+		server, client := net.Pipe()
+		c := newIdleConn(server, time.Nanosecond, newMetrics(), logger)
+
+		// checkIdle срабатывает почти сразу и закрывает соединение
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := client.Read(make([]byte, 1)); err == nil {
+			t.Fatal("idle connection not closed")
+		}
+		c.Close()
+		client.Close()
+	}
+}
+
+func TestProtocolListenerCountsConnections(t *testing.T) {
+	um := newTestMultiplexer(t, DefaultConfig())
+	um.RegisterGRPCService(registerPingService)
+	addr := um.config.Listener.Addr().String()
+	startTestMultiplexer(t, um)
+	before, _ := um.metrics.Snapshot()["counters"].(map[string]int64)
+
+	resp, err := http.Get("http://" + addr + "/health")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.Invoke(context.Background(), "/ultramux.test.Ping/Ping", &emptypb.Empty{}, &emptypb.Empty{}); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	// Не подошедшие ни одному матчеру соединения cmux отдает в ErrorHandler
+	um.handleMuxError(cmux.ErrNotMatched{})
+
+	counters, _ := um.metrics.Snapshot()["counters"].(map[string]int64)
+	for _, protocol := range []string{"http", "grpc", "unmatched"} {
+		name := "cmux_connections_" + protocol + "_total"
+		if got := counters[name] - before[name]; got != 1 {
+			t.Errorf("%s grew by %d, want 1", name, got)
+		}
+	}
+}
+
+func TestTimedConnCountsBytes(t *testing.T) {
+	um := NewUltraMultiplexer()
+	var open atomic.Int64
+	newConn := func() (*timedConn, net.Conn) {
+		server, client := net.Pipe()
+		go io.Copy(io.Discard, client)
+		return &timedConn{Conn: server, metrics: um.metrics, open: &open}, client
+	}
+
+	// Байты до матчинга переносятся в счетчики протокола
+	matched, client := newConn()
+	defer client.Close()
+	matched.Write([]byte("preface"))
+	matched.setProtocol("http")
+	matched.Write([]byte("body"))
+	matched.Close()
+	matched.Close()
+
+	unmatched, client := newConn()
+	defer client.Close()
+	unmatched.Write([]byte("junk"))
+	unmatched.Close()
+
+	rec := httptest.NewRecorder()
+	newHTTPHandler(um, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var stats struct {
+		Protocols map[string]struct {
+			BytesOut int64 `json:"bytes_out"`
+		} `json:"protocols"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode /stats: %v; body %s", err, rec.Body)
+	}
+	if got := stats.Protocols["http"].BytesOut; got != 11 {
+		t.Errorf("http bytes_out = %d, want 11", got)
+	}
+	if got := stats.Protocols["unmatched"].BytesOut; got != 4 {
+		t.Errorf("unmatched bytes_out = %d, want 4", got)
+	}
+	// Повторный Close не уменьшает gauge второй раз
+	if n := open.Load(); n != -2 {
+		t.Errorf("open connections delta = %d, want -2", n)
+	}
+}
+
+func TestObserveMatchLatency(t *testing.T) {
+	var out bytes.Buffer
+	config := DefaultConfig()
+	config.CmuxMatchSlowThreshold = 100 * time.Millisecond
+	um := NewUltraMultiplexer(WithConfig(config), WithLogger(log.New(&out, "", 0)))
+	remote := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+	um.observeMatchLatency("http", remote, 5*time.Millisecond)
+	um.observeMatchLatency("grpc", remote, 300*time.Millisecond)
+
+	logged := out.String()
+	if strings.Contains(logged, "http connection") {
+		t.Errorf("fast match logged:\n%s", logged)
+	}
+	if !strings.Contains(logged, "grpc connection from 10.0.0.1:5000 matched after 300ms") {
+		t.Errorf("slow match not logged:\n%s", logged)
+	}
+	histograms, _ := um.metrics.Snapshot()["histograms"].(map[string]interface{})
+	for name, want := range map[string]int64{"cmux_match_latency": 2, "cmux_match_latency_http": 1, "cmux_match_latency_grpc": 1} {
+		h, _ := histograms[name].(map[string]interface{})
+		if h["count"] != want {
+			t.Errorf("%s count = %v, want %d", name, h["count"], want)
+		}
+	}
+}
+
+// BenchmarkTCPTuning меряет цену опций Config.DisableTCPNoDelay и
+// TCPReadBuffer/TCPWriteBuffer на loopback: запрос-ответ, где сервер пишет
+// ответ двумя мелкими записями (заголовок кадра и тело, как HTTP/2 и gRPC),
+// и потоковую передачу 1 MiB
+func BenchmarkTCPTuning(b *testing.B) {
+	b.Run("roundtrip/nodelay", func(b *testing.B) { benchmarkTCPRoundTrip(b, tcpTuningListener{noDelay: true}) })
+	b.Run("roundtrip/nagle", func(b *testing.B) { benchmarkTCPRoundTrip(b, tcpTuningListener{noDelay: false}) })
+	b.Run("bulk/autotune", func(b *testing.B) { benchmarkTCPBulk(b, tcpTuningListener{noDelay: true}) })
+	b.Run("bulk/64KiB", func(b *testing.B) {
+		benchmarkTCPBulk(b, tcpTuningListener{noDelay: true, readBuffer: 64 << 10, writeBuffer: 64 << 10})
+	})
+}
+
+// startTuningListener запускает tcpTuningListener с параметрами opts и
+// обработчиком serve для единственного соединения
+func startTuningListener(b *testing.B, opts tcpTuningListener, serve func(net.Conn)) net.Conn {
+	b.Helper()
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatalf("listen: %v", err)
+	}
+	opts.Listener = inner
+	opts.logger = log.New(io.Discard, "", 0)
+	ln := &opts
+	b.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		serve(conn)
+	}()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		b.Fatalf("dial: %v", err)
+	}
+	b.Cleanup(func() { client.Close() })
+	return client
+}
+
+func benchmarkTCPRoundTrip(b *testing.B, opts tcpTuningListener) {
+	client := startTuningListener(b, opts, func(conn net.Conn) {
+		req := make([]byte, 64)
+		for {
+			if _, err := io.ReadFull(conn, req); err != nil {
+				return
+			}
+			if _, err := conn.Write(req[:9]); err != nil {
+				return
+			}
+			if _, err := conn.Write(req[9:]); err != nil {
+				return
+			}
+		}
+	})
+
+	buf := make([]byte, 64)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.Write(buf); err != nil {
+			b.Fatalf("write: %v", err)
+		}
+		if _, err := io.ReadFull(client, buf); err != nil {
+			b.Fatalf("read: %v", err)
+		}
+	}
+}
+
+func benchmarkTCPBulk(b *testing.B, opts tcpTuningListener) {
+	const size = 1 << 20
+	client := startTuningListener(b, opts, func(conn net.Conn) {
+		chunk := make([]byte, 32<<10)
+		ack := make([]byte, 1)
+		for {
+			for sent := 0; sent < size; sent += len(chunk) {
+				if _, err := conn.Write(chunk); err != nil {
+					return
+				}
+			}
+			if _, err := io.ReadFull(conn, ack); err != nil {
+				return
+			}
+		}
+	})
+
+	buf := make([]byte, 32<<10)
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for read := 0; read < size; {
+			n, err := client.Read(buf)
+			if err != nil {
+				b.Fatalf("read: %v", err)
+			}
+			read += n
+		}
+		if _, err := client.Write([]byte{1}); err != nil {
+			b.Fatalf("write: %v", err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package ultramux
+
+import (
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// effectiveCPUs возвращает число CPU с учетом квоты cgroup (v2, затем v1).
+// Без квоты - runtime.NumCPU().
+func effectiveCPUs() int {
+	cpus := runtime.NumCPU()
+	if quota, ok := cgroupCPUQuota(); ok {
+		limited := int(math.Ceil(quota))
+		if limited < 1 {
+			limited = 1
+		}
+		if limited < cpus {
+			cpus = limited
+		}
+	}
+	return cpus
+}
+
+// cgroupCPUQuota возвращает квоту в долях CPU (quota / period)
+func cgroupCPUQuota() (float64, bool) {
+	// cgroup v2: "max 100000" или "200000 100000"
+	if data, err := os.ReadFile("/sys/fs/cgroup/cpu.max"); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) == 2 && fields[0] != "max" {
+			return parseQuota(fields[0], fields[1])
+		}
+		return 0, false
+	}
+
+	// cgroup v1
+	quota, err := os.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_quota_us")
+	if err != nil {
+		return 0, false
+	}
+	period, err := os.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_period_us")
+	if err != nil {
+		return 0, false
+	}
+	return parseQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+func parseQuota(quotaStr, periodStr string) (float64, bool) {
+	quota, err := strconv.ParseFloat(quotaStr, 64)
+	if err != nil || quota <= 0 {
+		return 0, false
+	}
+	period, err := strconv.ParseFloat(periodStr, 64)
+	if err != nil || period <= 0 {
+		return 0, false
+	}
+	return quota / period, true
+}
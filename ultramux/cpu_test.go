@@ -0,0 +1,50 @@
+package ultramux
+
+import "testing"
+
+func TestParseQuota(t *testing.T) {
+	tests := []struct {
+		name   string
+		quota  string
+		period string
+		want   float64
+		wantOK bool
+	}{
+		{"two cpus", "200000", "100000", 2, true},
+		{"fractional", "150000", "100000", 1.5, true},
+		{"unlimited v1", "-1", "100000", 0, false},
+		{"zero period", "100000", "0", 0, false},
+		{"garbage", "max", "100000", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseQuota(tt.quota, tt.period)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("parseQuota(%q, %q) = %v, %v; want %v, %v", tt.quota, tt.period, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGRPCStreamWorkers(t *testing.T) {
+	tests := []struct {
+		name     string
+		autoTune bool
+		workers  int
+		want     int
+	}{
+		{"disabled keeps configured", false, 0, 0},
+		{"explicit wins over auto", true, 3, 3},
+		{"auto uses cpu count", true, 0, effectiveCPUs()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.AutoTuneCPU = tt.autoTune
+			config.GRPCStreamWorkers = tt.workers
+			if got := NewUltraMultiplexer(WithConfig(config)).grpcStreamWorkers(); got != tt.want {
+				t.Fatalf("grpcStreamWorkers = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
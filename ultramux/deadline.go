@@ -0,0 +1,24 @@
+package ultramux
+
+import "context"
+
+// UpstreamContext выводит контекст для исходящего HTTP запроса из контекста
+// входящего gRPC вызова: HTTP вызов получает оставшийся бюджет времени
+// gRPC дедлайна за вычетом Config.UpstreamDeadlineMargin. Отмена gRPC вызова
+// отменяет и HTTP запрос.
+//
+//	ctx, cancel := um.UpstreamContext(grpcCtx)
+//	defer cancel()
+//	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+func (um *UltraMultiplexer) UpstreamContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+
+	remaining := deadline.Sub(um.clock.Now()) - um.config.UpstreamDeadlineMargin
+	if remaining < 0 {
+		remaining = 0
+	}
+	return context.WithTimeout(ctx, remaining)
+}
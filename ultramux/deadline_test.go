@@ -0,0 +1,54 @@
+package ultramux
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUpstreamContext(t *testing.T) {
+	config := DefaultConfig()
+	config.UpstreamDeadlineMargin = 2 * time.Second
+	um := NewUltraMultiplexer(WithConfig(config))
+
+	grpcCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ctx, cancelUpstream := um.UpstreamContext(grpcCtx)
+	defer cancelUpstream()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		t.Fatal("upstream context has no deadline")
+	}
+	if remaining := time.Until(deadline); remaining > 8*time.Second || remaining < 7*time.Second {
+		t.Fatalf("upstream budget = %v, want about 8s", remaining)
+	}
+
+	// Отмена gRPC вызова отменяет HTTP запрос
+	cancel()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("upstream context not canceled with the gRPC call")
+	}
+}
+
+func TestUpstreamContextEdgeCases(t *testing.T) {
+	config := DefaultConfig()
+	config.UpstreamDeadlineMargin = time.Second
+	um := NewUltraMultiplexer(WithConfig(config))
+
+	ctx, cancel := um.UpstreamContext(context.Background())
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("deadline added to a call without one")
+	}
+
+	// Бюджет меньше запаса - HTTP запрос даже не начинается
+	short, cancelShort := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancelShort()
+	ctx, cancel = um.UpstreamContext(short)
+	defer cancel()
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want DeadlineExceeded", ctx.Err())
+	}
+}
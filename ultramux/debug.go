@@ -0,0 +1,31 @@
+package ultramux
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	pb "ultramultiplexer/pb/pb"
+)
+
+// DebugServer отдает клиенту то, что дошло до сервера: входящие метаданные
+// и адрес пира. Помогает проверять работу интерсепторов и проброс метаданных.
+type DebugServer struct {
+	pb.UnimplementedDebugServiceServer
+}
+
+func (s *DebugServer) Echo(ctx context.Context, req *pb.EchoRequest) (*pb.EchoReply, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	reply := &pb.EchoReply{
+		Metadata: make(map[string]*pb.MetadataValues, len(md)),
+	}
+	for key, values := range md {
+		reply.Metadata[key] = &pb.MetadataValues{Values: values}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		reply.Peer = p.Addr.String()
+	}
+	return reply, nil
+}
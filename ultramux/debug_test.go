@@ -0,0 +1,32 @@
+package ultramux
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	pb "ultramultiplexer/pb/pb"
+)
+
+func TestDebugEcho(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "r1", "x-tag", "a", "x-tag", "b"))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}})
+
+	reply, err := (&DebugServer{}).Echo(ctx, &pb.EchoRequest{})
+	if err != nil {
+		t.Fatalf("Echo: %v", err)
+	}
+	if reply.Peer != "10.0.0.1:5000" {
+		t.Errorf("peer = %q, want 10.0.0.1:5000", reply.Peer)
+	}
+	if got := reply.Metadata["x-request-id"].GetValues(); len(got) != 1 || got[0] != "r1" {
+		t.Errorf("x-request-id = %v, want [r1]", got)
+	}
+	// Повторяющиеся ключи сохраняют все значения по порядку
+	if got := reply.Metadata["x-tag"].GetValues(); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("x-tag = %v, want [a b]", got)
+	}
+}
@@ -0,0 +1,132 @@
+package ultramux
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// DNSCacheConfig - кэш разрешения имен upstream'ов /proxy. Применяется к
+// клиенту по умолчанию и транспортам ProxyTarget.TLS; клиент из
+// Config.HTTPClient не трогается
+type DNSCacheConfig struct {
+	// TTL успешного ответа. 0 - кэш выключен
+	TTL time.Duration
+	// NegativeTTL - сколько помнить несуществующие имена (NXDOMAIN).
+	// 0 - не кэшировать; временные ошибки резолвера не кэшируются никогда
+	NegativeTTL time.Duration
+	// MaxEntries ограничивает число имен в кэше; 0 - 1024
+	MaxEntries int
+}
+
+type dnsCacheEntry struct {
+	addrs   []string
+	err     error
+	expires time.Time
+}
+
+type dnsCache struct {
+	cfg      DNSCacheConfig
+	clock    Clock
+	resolver *net.Resolver
+	dialer   *net.Dialer
+
+	mu      sync.Mutex
+	entries map[string]dnsCacheEntry
+}
+
+func newDNSCache(cfg DNSCacheConfig, clock Clock) *dnsCache {
+	if cfg.TTL <= 0 {
+		return nil
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = 1024
+	}
+	return &dnsCache{
+		cfg:      cfg,
+		clock:    clock,
+		resolver: net.DefaultResolver,
+		dialer:   &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		entries:  make(map[string]dnsCacheEntry),
+	}
+}
+
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	now := c.clock.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.addrs, entry.err
+	}
+
+	addrs, err := c.resolver.LookupHost(ctx, host)
+	ttl := c.cfg.TTL
+	if err != nil {
+		var dnsErr *net.DNSError
+		if c.cfg.NegativeTTL <= 0 || !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			return nil, err
+		}
+		ttl = c.cfg.NegativeTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[host]; !exists && len(c.entries) >= c.cfg.MaxEntries {
+		c.evictLocked(now)
+	}
+	c.entries[host] = dnsCacheEntry{addrs: addrs, err: err, expires: now.Add(ttl)}
+	return addrs, err
+}
+
+// evictLocked удаляет просроченные записи, а если таких нет - ближайшую к
+// истечению
+func (c *dnsCache) evictLocked(now time.Time) {
+	var oldest string
+	var oldestExpires time.Time
+	for host, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, host)
+			continue
+		}
+		if oldest == "" || entry.expires.Before(oldestExpires) {
+			oldest, oldestExpires = host, entry.expires
+		}
+	}
+	if len(c.entries) >= c.cfg.MaxEntries {
+		delete(c.entries, oldest)
+	}
+}
+
+// dialContext - DialContext для http.Transport: перебирает закэшированные
+// адреса, пока один не ответит
+func (c *dnsCache) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return c.dialer.DialContext(ctx, network, addr)
+	}
+
+	addrs, err := c.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+
+	var lastErr error
+	for _, ip := range addrs {
+		conn, err := c.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,149 @@
+package ultramux
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeDNSResolver отвечает на A запросы к upstream.test адресом 127.0.0.1,
+// на остальные - NXDOMAIN, и считает запросы
+func fakeDNSResolver(queries *atomic.Int64) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			server, client := net.Pipe()
+			go serveFakeDNS(server, queries)
+			return client, nil
+		},
+	}
+}
+
+// serveFakeDNS обслуживает DNS поверх потокового соединения (кадры с
+// двухбайтовой длиной, как у DNS over TCP)
+func serveFakeDNS(conn net.Conn, queries *atomic.Int64) {
+	defer conn.Close()
+	for {
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		packet := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, packet); err != nil {
+			return
+		}
+		var msg dnsmessage.Message
+		if err := msg.Unpack(packet); err != nil || len(msg.Questions) == 0 {
+			return
+		}
+		queries.Add(1)
+
+		question := msg.Questions[0]
+		msg.Header.Response = true
+		msg.Header.Authoritative = true
+		switch {
+		case question.Name.String() != "upstream.test.":
+			msg.Header.RCode = dnsmessage.RCodeNameError
+		case question.Type == dnsmessage.TypeA:
+			msg.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+			}}
+		}
+		reply, err := msg.Pack()
+		if err != nil {
+			return
+		}
+		binary.BigEndian.PutUint16(size[:], uint16(len(reply)))
+		if _, err := conn.Write(append(size[:], reply...)); err != nil {
+			return
+		}
+	}
+}
+
+func TestDNSCacheTTL(t *testing.T) {
+	var queries atomic.Int64
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	cache := newDNSCache(DNSCacheConfig{TTL: time.Minute, NegativeTTL: 10 * time.Second}, clock)
+	cache.resolver = fakeDNSResolver(&queries)
+	ctx := context.Background()
+
+	lookup := func(host string) int64 {
+		t.Helper()
+		before := queries.Load()
+		cache.lookup(ctx, host)
+		return queries.Load() - before
+	}
+
+	if n := lookup("upstream.test"); n == 0 {
+		t.Fatal("first lookup did not reach the resolver")
+	}
+	if addrs, err := cache.lookup(ctx, "upstream.test"); err != nil || len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Fatalf("lookup = %v, %v; want [127.0.0.1]", addrs, err)
+	}
+	if n := lookup("upstream.test"); n != 0 {
+		t.Fatalf("cached name resolved again (%d queries)", n)
+	}
+	clock.Advance(time.Minute)
+	if n := lookup("upstream.test"); n == 0 {
+		t.Fatal("expired entry not resolved again")
+	}
+
+	// NXDOMAIN помнится NegativeTTL
+	if _, err := cache.lookup(ctx, "missing.test"); err == nil {
+		t.Fatal("missing name resolved")
+	}
+	if n := lookup("missing.test"); n != 0 {
+		t.Fatalf("NXDOMAIN not cached (%d queries)", n)
+	}
+	clock.Advance(10 * time.Second)
+	if n := lookup("missing.test"); n == 0 {
+		t.Fatal("NXDOMAIN cached past NegativeTTL")
+	}
+}
+
+func TestDNSCacheEvictsSoonestExpiring(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	cache := newDNSCache(DNSCacheConfig{TTL: time.Minute, MaxEntries: 2}, clock)
+	cache.entries["a.test"] = dnsCacheEntry{expires: clock.Now().Add(time.Second)}
+	cache.entries["b.test"] = dnsCacheEntry{expires: clock.Now().Add(time.Hour)}
+
+	cache.mu.Lock()
+	cache.evictLocked(clock.Now())
+	cache.mu.Unlock()
+	if _, ok := cache.entries["a.test"]; ok || len(cache.entries) != 1 {
+		t.Fatalf("entries after eviction: %v, want only b.test", cache.entries)
+	}
+}
+
+func TestDNSCacheDial(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+	_, port, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+
+	var queries atomic.Int64
+	cache := newDNSCache(DNSCacheConfig{TTL: time.Minute}, realClock{})
+	cache.resolver = fakeDNSResolver(&queries)
+	client := &http.Client{Transport: &http.Transport{DialContext: cache.dialContext, DisableKeepAlives: true}}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get("http://upstream.test:" + port)
+		if err != nil {
+			t.Fatalf("GET via cached name: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if n := queries.Load(); n == 0 || n > 2 {
+		t.Fatalf("resolver saw %d queries for two requests, want one lookup", n)
+	}
+}
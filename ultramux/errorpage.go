@@ -0,0 +1,107 @@
+package ultramux
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const defaultErrorPage = `<!DOCTYPE html>
+<html>
+<head><title>{{.Status}} {{.StatusText}}</title></head>
+<body>
+<h1>{{.Status}} {{.StatusText}}</h1>
+<p>{{.Message}}</p>
+{{if .RequestID}}<p><small>Request ID: {{.RequestID}}</small></p>{{end}}
+</body>
+</html>
+`
+
+// errorPageData - данные для шаблона Config.ErrorPageTemplate
+type errorPageData struct {
+	Status     int
+	StatusText string
+	Message    string
+	RequestID  string
+}
+
+// parseErrorPage разбирает шаблон HTML страницы ошибки
+func (um *UltraMultiplexer) parseErrorPage() error {
+	if !um.config.HTMLErrorPages {
+		return nil
+	}
+	source := um.config.ErrorPageTemplate
+	if source == "" {
+		source = defaultErrorPage
+	}
+	tmpl, err := template.New("error").Parse(source)
+	if err != nil {
+		return fmt.Errorf("%w: error page template: %w", ErrInvalidConfig, err)
+	}
+	um.errorPage = tmpl
+	return nil
+}
+
+// writeError отдает ошибку в JSON, а браузерам (Accept предпочитает
+// text/html) - HTML страницу, если включен HTMLErrorPages
+func (um *UltraMultiplexer) writeError(w http.ResponseWriter, r *http.Request, code int, message string) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if um.errorPage != nil && prefersHTML(r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(code)
+		err := um.errorPage.Execute(w, errorPageData{
+			Status:     code,
+			StatusText: http.StatusText(code),
+			Message:    message,
+			RequestID:  RequestIDFromContext(r.Context()),
+		})
+		if err != nil {
+			um.logger.Printf("⚠️ Failed to render error page: %v", err)
+		}
+		return
+	}
+
+	um.writeJSON(w, code, map[string]interface{}{
+		"error":  message,
+		"status": code,
+	})
+}
+
+// prefersHTML сравнивает q-веса text/html и application/json в Accept
+func prefersHTML(accept string) bool {
+	weights := acceptWeights(accept)
+	htmlQ := max(weights.q("text/html"), weights.q("application/xhtml+xml"))
+	return htmlQ > 0 && htmlQ > weights.q("application/json")
+}
+
+// acceptQuality - q-веса медиа типов из заголовка Accept
+type acceptQuality map[string]float64
+
+// q - вес типа; -1, если тип в Accept не упомянут
+func (a acceptQuality) q(mediaType string) float64 {
+	if q, ok := a[mediaType]; ok {
+		return q
+	}
+	return -1
+}
+
+func acceptWeights(accept string) acceptQuality {
+	weights := make(acceptQuality)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		weights[mediaType] = max(weights.q(mediaType), q)
+	}
+	return weights
+}
@@ -0,0 +1,69 @@
+package ultramux
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteErrorNegotiatesFormat(t *testing.T) {
+	config := DefaultConfig()
+	config.HTMLErrorPages = true
+	um := NewUltraMultiplexer(WithConfig(config))
+	if err := um.parseErrorPage(); err != nil {
+		t.Fatalf("parseErrorPage: %v", err)
+	}
+
+	tests := []struct {
+		accept   string
+		wantHTML bool
+	}{
+		{"text/html,application/xhtml+xml,*/*;q=0.8", true},
+		{"application/json", false},
+		{"text/html;q=0.5, application/json", false},
+		{"*/*", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/proxy", nil)
+			req.Header.Set("Accept", tt.accept)
+			req = req.WithContext(withRequestID(req.Context(), "req-1"))
+			rec := httptest.NewRecorder()
+			um.writeError(rec, req, http.StatusBadGateway, "<upstream> failed")
+
+			if rec.Code != http.StatusBadGateway {
+				t.Fatalf("status = %d, want 502", rec.Code)
+			}
+			isHTML := strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html")
+			if isHTML != tt.wantHTML {
+				t.Fatalf("Content-Type = %q, want HTML %v", rec.Header().Get("Content-Type"), tt.wantHTML)
+			}
+			if isHTML && (!strings.Contains(rec.Body.String(), "&lt;upstream&gt; failed") || !strings.Contains(rec.Body.String(), "req-1")) {
+				t.Fatalf("HTML page = %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestWriteErrorJSONWithoutHTMLPages(t *testing.T) {
+	um := NewUltraMultiplexer()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+	um.writeError(rec, req, http.StatusNotFound, "not found")
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("Content-Type = %q, want JSON", rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestBadErrorPageTemplate(t *testing.T) {
+	config := DefaultConfig()
+	config.HTMLErrorPages = true
+	config.ErrorPageTemplate = "{{.Status"
+	if err := NewUltraMultiplexer(WithConfig(config)).parseErrorPage(); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("parseErrorPage = %v, want ErrInvalidConfig", err)
+	}
+}
@@ -0,0 +1,35 @@
+package ultramux
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Ошибки жизненного цикла. Возвращаемые ошибки оборачивают их через %w,
+// поэтому вызывающий код может различать причины через errors.Is.
+var (
+	ErrListen          = errors.New("failed to create listener")
+	ErrPortInUse       = errors.New("port already in use")
+	ErrTLSConfig       = errors.New("invalid TLS configuration")
+	ErrInvalidConfig   = errors.New("invalid configuration")
+	ErrServersNotReady = errors.New("servers not ready")
+	ErrMuxNotServing   = errors.New("cmux is not serving")
+	ErrGRPCClientInit  = errors.New("failed to initialize gRPC client")
+	ErrServeNotExited  = errors.New("serve goroutines did not exit")
+	// ErrInvalidTransition - вызов не в той стадии жизненного цикла
+	// (повторный Initialize, Start до Initialize или после Stop)
+	ErrInvalidTransition = errors.New("invalid lifecycle transition")
+	// ErrStopped - Start прерван остановкой мультиплексора
+	ErrStopped = errors.New("multiplexer stopped")
+)
+
+// ForceStopError сообщает, какие подсистемы не успели завершиться штатно
+// и были остановлены принудительно
+type ForceStopError struct {
+	Subsystems []string
+}
+
+func (e *ForceStopError) Error() string {
+	return fmt.Sprintf("force-stopped: %s", strings.Join(e.Subsystems, ", "))
+}
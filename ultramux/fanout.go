@@ -0,0 +1,100 @@
+package ultramux
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// FanOutResult - ответ одного target'а в FanOutGET. Err заполнен, если
+// запрос не удался; остальные target'ы от этого не страдают.
+type FanOutResult struct {
+	Target     string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Err        error
+}
+
+// FanOutGET параллельно выполняет GET к каждому target'у, не больше
+// Config.FanOutConcurrency одновременно, под общим дедлайном FanOutTimeout.
+// Результаты возвращаются в порядке targets; частичные отказы не прерывают
+// остальные запросы, отмена ctx прерывает все.
+func (um *UltraMultiplexer) FanOutGET(ctx context.Context, targets []string) []FanOutResult {
+	ctx, cancel := withOptionalTimeout(ctx, um.config.FanOutTimeout)
+	defer cancel()
+
+	workers := um.config.FanOutConcurrency
+	if workers <= 0 || workers > len(targets) {
+		workers = len(targets)
+	}
+
+	results := make([]FanOutResult, len(targets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = um.fanOutOne(ctx, targets[i])
+				um.metrics.Inc("fanout_requests_total")
+				if results[i].Err != nil {
+					um.metrics.Inc("fanout_errors_total")
+				}
+			}
+		}()
+	}
+
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func (um *UltraMultiplexer) fanOutOne(ctx context.Context, target string) FanOutResult {
+	result := FanOutResult{Target: target}
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+		return result
+	}
+
+	targetURL, err := url.Parse(target)
+	if err != nil || (targetURL.Scheme != "http" && targetURL.Scheme != "https") || targetURL.Host == "" {
+		result.Err = fmt.Errorf("invalid target URL %q", target)
+		return result
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	resp, err := um.getHTTPClient().Do(req)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	result.Header = resp.Header
+
+	var body io.Reader = resp.Body
+	maxBytes := um.proxyMaxResponseBytes(um.proxyTargetFor(targetURL))
+	if maxBytes > 0 {
+		body = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	result.Body, result.Err = io.ReadAll(body)
+	if maxBytes > 0 && int64(len(result.Body)) > maxBytes {
+		result.Body = result.Body[:maxBytes]
+		result.Err = fmt.Errorf("response larger than %d bytes", maxBytes)
+	}
+	return result
+}
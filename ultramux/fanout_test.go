@@ -0,0 +1,77 @@
+package ultramux
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFanOutGETBoundsConcurrency(t *testing.T) {
+	var active, peak atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer upstream.Close()
+
+	config := DefaultConfig()
+	config.FanOutConcurrency = 2
+	um := NewUltraMultiplexer(WithConfig(config))
+
+	targets := []string{upstream.URL + "/a", upstream.URL + "/b", "ftp://example.com", upstream.URL + "/c", upstream.URL + "/d"}
+	results := um.FanOutGET(context.Background(), targets)
+
+	if p := peak.Load(); p > 2 {
+		t.Fatalf("peak concurrency = %d, want <= 2", p)
+	}
+	for i, res := range results {
+		if res.Target != targets[i] {
+			t.Fatalf("result %d target = %q, want %q", i, res.Target, targets[i])
+		}
+	}
+	if results[2].Err == nil {
+		t.Fatal("invalid target did not fail")
+	}
+	if results[3].Err != nil || string(results[3].Body) != "/c" {
+		t.Fatalf("result 3 = %q, %v; want /c", results[3].Body, results[3].Err)
+	}
+}
+
+func TestFanOutGETSharedTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		io.WriteString(w, "fast")
+	}))
+	defer upstream.Close()
+
+	config := DefaultConfig()
+	config.FanOutTimeout = 100 * time.Millisecond
+	um := NewUltraMultiplexer(WithConfig(config))
+
+	start := time.Now()
+	results := um.FanOutGET(context.Background(), []string{upstream.URL + "/fast", upstream.URL + "/slow"})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("FanOutGET took %v", elapsed)
+	}
+	if results[0].Err != nil || string(results[0].Body) != "fast" {
+		t.Fatalf("fast result = %q, %v", results[0].Body, results[0].Err)
+	}
+	if results[1].Err == nil {
+		t.Fatal("slow target did not time out")
+	}
+}
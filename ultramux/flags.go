@@ -0,0 +1,83 @@
+package ultramux
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+const adminFlagsPath = "/admin/flags"
+
+// featureFlags - включенность HTTP эндпоинтов, переключаемая на лету
+type featureFlags struct {
+	mu       sync.RWMutex
+	disabled map[string]bool
+}
+
+func newFeatureFlags(disabled []string) *featureFlags {
+	f := &featureFlags{disabled: make(map[string]bool)}
+	for _, path := range disabled {
+		f.disabled[path] = true
+	}
+	return f
+}
+
+func (f *featureFlags) enabled(path string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return !f.disabled[path]
+}
+
+func (f *featureFlags) set(path string, enabled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if enabled {
+		delete(f.disabled, path)
+	} else {
+		f.disabled[path] = true
+	}
+}
+
+// SetEndpointEnabled включает или выключает HTTP эндпоинт; выключенный
+// отвечает 503
+func (um *UltraMultiplexer) SetEndpointEnabled(path string, enabled bool) {
+	um.flags.set(path, enabled)
+	um.logger.Printf("⚙️ Endpoint %s enabled=%t", path, enabled)
+}
+
+// flagsHandler: GET возвращает состояние эндпоинтов, POST принимает
+// {"/proxy": false, ...} и возвращает новое состояние
+func (h *HTTPHandler) flagsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var update map[string]bool
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&update); err != nil {
+			h.multiplexer.writeError(w, r, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+			return
+		}
+		for path := range update {
+			if _, ok := h.routes[path]; !ok {
+				h.multiplexer.writeError(w, r, http.StatusBadRequest, "unknown endpoint "+path)
+				return
+			}
+			if path == adminFlagsPath {
+				h.multiplexer.writeError(w, r, http.StatusBadRequest, adminFlagsPath+" cannot be disabled")
+				return
+			}
+		}
+		for path, enabled := range update {
+			h.multiplexer.SetEndpointEnabled(path, enabled)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		h.multiplexer.writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	state := make(map[string]bool, len(h.paths))
+	for _, path := range h.paths {
+		state[path] = h.multiplexer.flags.enabled(path)
+	}
+	h.multiplexer.writeJSON(w, 0, state)
+}
@@ -0,0 +1,51 @@
+package ultramux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEndpointKillSwitch(t *testing.T) {
+	config := DefaultConfig()
+	config.AdminToken = "secret"
+	config.DisabledEndpoints = []string{"/metrics"}
+	handler := newHTTPHandler(NewUltraMultiplexer(WithConfig(config)), nil)
+
+	serve := func(method, path, token, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if got := serve(http.MethodGet, "/metrics", "", ""); got != http.StatusServiceUnavailable {
+		t.Fatalf("disabled /metrics = %d, want 503", got)
+	}
+
+	steps := []struct {
+		name  string
+		token string
+		body  string
+		want  int
+	}{
+		{"no admin token", "", `{"/metrics": true}`, http.StatusUnauthorized},
+		{"unknown endpoint", "secret", `{"/nope": false}`, http.StatusBadRequest},
+		{"flags endpoint itself", "secret", `{"/admin/flags": false}`, http.StatusBadRequest},
+		{"invalid JSON", "secret", `{`, http.StatusBadRequest},
+		{"enable", "secret", `{"/metrics": true}`, http.StatusOK},
+	}
+	for _, step := range steps {
+		if got := serve(http.MethodPost, adminFlagsPath, step.token, step.body); got != step.want {
+			t.Fatalf("%s: status = %d, want %d", step.name, got, step.want)
+		}
+	}
+
+	if got := serve(http.MethodGet, "/metrics", "", ""); got != http.StatusOK {
+		t.Fatalf("re-enabled /metrics = %d, want 200", got)
+	}
+}
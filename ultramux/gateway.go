@@ -0,0 +1,160 @@
+package ultramux
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	pb "ultramultiplexer/pb/pb"
+)
+
+// validateGatewayServices не дает открыть DebugService через /gateway
+func (um *UltraMultiplexer) validateGatewayServices() error {
+	for _, service := range um.config.GatewayServices {
+		if service == pb.DebugService_ServiceDesc.ServiceName {
+			return fmt.Errorf("%w: %s cannot be exposed via /gateway", ErrInvalidConfig, service)
+		}
+	}
+	return nil
+}
+
+// buildGatewayServices фиксирует сервисы /gateway; вызывается после
+// регистрации всех сервисов на gRPC сервере
+func (um *UltraMultiplexer) buildGatewayServices() {
+	um.gatewayServices = make(map[string]bool)
+	if um.config.GatewayServices != nil {
+		for _, service := range um.config.GatewayServices {
+			um.gatewayServices[service] = true
+		}
+		return
+	}
+	for service := range um.grpcServer.GetServiceInfo() {
+		if service == pb.DebugService_ServiceDesc.ServiceName || strings.HasPrefix(service, "grpc.") {
+			continue
+		}
+		um.gatewayServices[service] = true
+	}
+}
+
+// gatewayMethod находит дескриптор метода по имени: "SayHello" для
+// UltraService или полное "/pkg.Service/Method" для сервисов из
+// gatewayServices, чьи дескрипторы зарегистрированы в protoregistry
+func (um *UltraMultiplexer) gatewayMethod(name string) (protoreflect.MethodDescriptor, string, error) {
+	service, method := pb.UltraService_ServiceDesc.ServiceName, name
+	if full := strings.TrimPrefix(name, "/"); strings.Contains(full, "/") {
+		service, method, _ = strings.Cut(full, "/")
+	}
+	if !um.gatewayServices[service] {
+		return nil, "", fmt.Errorf("unknown service %q", service)
+	}
+
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, "", fmt.Errorf("unknown service %q", service)
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, "", fmt.Errorf("%q is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, "", fmt.Errorf("unknown method %q in %s", method, service)
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, "", fmt.Errorf("streaming method %s is not supported", md.FullName())
+	}
+	return md, "/" + service + "/" + method, nil
+}
+
+// gatewayMethods перечисляет unary методы, доступные через /gateway: короткие
+// имена для UltraService и полные /pkg.Service/Method для остальных
+func (um *UltraMultiplexer) gatewayMethods() []string {
+	var methods []string
+	for _, service := range um.grpcIndex() {
+		for _, method := range service.Methods {
+			if _, _, err := um.gatewayMethod("/" + service.Service + "/" + method); err != nil {
+				continue
+			}
+			if service.Service == pb.UltraService_ServiceDesc.ServiceName {
+				methods = append(methods, method)
+			} else {
+				methods = append(methods, "/"+service.Service+"/"+method)
+			}
+		}
+	}
+	return methods
+}
+
+// gatewayCall транскодирует JSON тело в запрос метода из параметра method,
+// вызывает его через внутренний gRPC клиент и отдает ответ как JSON.
+// Новые RPC становятся доступны без изменений HTTP слоя.
+func (h *HTTPHandler) gatewayCall(w http.ResponseWriter, r *http.Request) {
+	um := h.multiplexer
+
+	md, fullMethod, err := um.gatewayMethod(r.URL.Query().Get("method"))
+	if err != nil {
+		// Список доступных методов помогает найти API перебором
+		um.writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error":             err.Error(),
+			"status":            http.StatusNotFound,
+			"available_methods": um.gatewayMethods(),
+		})
+		return
+	}
+
+	conn := um.currentGRPCConn()
+	if conn == nil {
+		um.writeError(w, r, http.StatusServiceUnavailable, "gRPC client not ready")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		um.writeError(w, r, http.StatusBadRequest, "failed to read body: "+err.Error())
+		return
+	}
+	in := dynamicpb.NewMessage(md.Input())
+	if len(body) > 0 {
+		if err := protojson.Unmarshal(body, in); err != nil {
+			um.writeError(w, r, http.StatusBadRequest, "invalid request for "+string(md.Input().FullName())+": "+err.Error())
+			return
+		}
+	}
+
+	timeout, err := um.bridgeTimeout(r)
+	if err != nil {
+		um.writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(um.forwardCredentials(r.Context()), timeout)
+	defer cancel()
+
+	out := dynamicpb.NewMessage(md.Output())
+	var header, trailer metadata.MD
+	header, trailer, err = um.invokeGRPC(ctx, func(opts ...grpc.CallOption) error {
+		return conn.Invoke(ctx, fullMethod, in, out, opts...)
+	})
+	setGRPCMetadataHeaders(w.Header(), "Grpc-Metadata-", header)
+	setGRPCMetadataHeaders(w.Header(), "Grpc-Trailer-", trailer)
+	if err != nil {
+		um.writeGRPCError(w, err)
+		return
+	}
+
+	raw, err := protojson.MarshalOptions{Indent: um.config.JSON.Indent}.Marshal(out)
+	if err != nil {
+		um.writeError(w, r, http.StatusInternalServerError, "failed to encode response: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(raw)
+}
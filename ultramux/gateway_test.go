@@ -0,0 +1,99 @@
+package ultramux
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	pb "ultramultiplexer/pb/pb"
+)
+
+func TestGatewayServicesDefaultToRegistered(t *testing.T) {
+	um := NewUltraMultiplexer()
+	um.grpcServer = grpc.NewServer()
+	registerPingService(um.grpcServer)
+	healthpb.RegisterHealthServer(um.grpcServer, health.NewServer())
+	um.grpcServer.RegisterService(&grpc.ServiceDesc{
+		ServiceName: pb.DebugService_ServiceDesc.ServiceName,
+		HandlerType: (*interface{})(nil),
+	}, struct{}{})
+	um.buildGatewayServices()
+
+	if !um.gatewayServices[pingService.ServiceName] {
+		t.Errorf("registered service %s not exposed", pingService.ServiceName)
+	}
+	for _, hidden := range []string{pb.DebugService_ServiceDesc.ServiceName, healthpb.Health_ServiceDesc.ServiceName} {
+		if um.gatewayServices[hidden] {
+			t.Errorf("%s exposed by default", hidden)
+		}
+	}
+
+	// Сервис не открыт, хотя его дескрипторы есть в protoregistry
+	rec := httptest.NewRecorder()
+	newHTTPHandler(um, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/gateway?method=/grpc.health.v1.Health/Check", strings.NewReader("{}")))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestGatewayServicesAllowlist(t *testing.T) {
+	config := DefaultConfig()
+	config.GatewayServices = []string{healthpb.Health_ServiceDesc.ServiceName}
+	um := NewUltraMultiplexer(WithConfig(config))
+	um.grpcServer = grpc.NewServer()
+	registerPingService(um.grpcServer)
+	um.buildGatewayServices()
+
+	if _, _, err := um.gatewayMethod("/grpc.health.v1.Health/Check"); err != nil {
+		t.Fatalf("allowlisted method rejected: %v", err)
+	}
+	if um.gatewayServices[pingService.ServiceName] {
+		t.Fatalf("%s exposed despite the allowlist", pingService.ServiceName)
+	}
+}
+
+func TestGatewayServicesRejectDebugService(t *testing.T) {
+	config := DefaultConfig()
+	config.GatewayServices = []string{pb.DebugService_ServiceDesc.ServiceName}
+	um := NewUltraMultiplexer(WithConfig(config))
+	if err := um.validateGatewayServices(); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("validateGatewayServices = %v, want ErrInvalidConfig", err)
+	}
+}
+
+func TestGatewayUnknownMethodListsAvailable(t *testing.T) {
+	config := DefaultConfig()
+	config.GatewayServices = []string{healthpb.Health_ServiceDesc.ServiceName}
+	um := NewUltraMultiplexer(WithConfig(config))
+	um.grpcServer = grpc.NewServer()
+	healthpb.RegisterHealthServer(um.grpcServer, health.NewServer())
+	um.buildGatewayServices()
+
+	rec := httptest.NewRecorder()
+	newHTTPHandler(um, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/gateway?method=/grpc.health.v1.Health/Nope", strings.NewReader("{}")))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+	var body struct {
+		Error            string   `json:"error"`
+		AvailableMethods []string `json:"available_methods"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v; body %s", err, rec.Body)
+	}
+	if !strings.Contains(body.Error, "Nope") {
+		t.Errorf("error = %q, want the unknown method named", body.Error)
+	}
+	// Потоковый Watch через gateway не вызвать
+	if !slices.Contains(body.AvailableMethods, "/grpc.health.v1.Health/Check") || slices.Contains(body.AvailableMethods, "/grpc.health.v1.Health/Watch") {
+		t.Errorf("available_methods = %v, want unary health methods only", body.AvailableMethods)
+	}
+}
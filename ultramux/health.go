@@ -0,0 +1,160 @@
+package ultramux
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthResponseConfig настраивает ответ /health под конкретный балансировщик
+type HealthResponseConfig struct {
+	// Fields - статические поля (регион, ID инстанса), добавляемые в ответ;
+	// могут переопределить service и timestamp
+	Fields map[string]interface{}
+	// DrainingStatusCode - код ответа во время Shutdown; 0 - 200,
+	// liveness при дренаже не падает
+	DrainingStatusCode int
+}
+
+// UpstreamDependency описывает upstream, от здоровья которого зависит готовность
+type UpstreamDependency struct {
+	Name string
+	URL  string
+	// Required: при недоступности зависимости /readyz отвечает not ready
+	Required bool
+}
+
+type dependencyStatus struct {
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Required  bool      `json:"required"`
+	Healthy   bool      `json:"healthy"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// dependencyChecker проверяет upstream зависимости и кэширует результат,
+// чтобы /readyz не дергал их на каждый запрос
+type dependencyChecker struct {
+	deps   []UpstreamDependency
+	ttl    time.Duration
+	client *http.Client
+	clock  Clock
+
+	mu    sync.Mutex
+	cache map[string]dependencyStatus
+}
+
+func newDependencyChecker(deps []UpstreamDependency, ttl time.Duration, clock Clock) *dependencyChecker {
+	if ttl <= 0 {
+		ttl = 5 * time.Second
+	}
+	return &dependencyChecker{
+		deps:   deps,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 2 * time.Second},
+		clock:  clock,
+		cache:  make(map[string]dependencyStatus),
+	}
+}
+
+func (dc *dependencyChecker) check() []dependencyStatus {
+	statuses := make([]dependencyStatus, len(dc.deps))
+
+	var wg sync.WaitGroup
+	for i, dep := range dc.deps {
+		if cached, ok := dc.cached(dep.URL); ok {
+			cached.Name = dep.Name
+			cached.Required = dep.Required
+			statuses[i] = cached
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, dep UpstreamDependency) {
+			defer wg.Done()
+			statuses[i] = dc.probe(dep)
+		}(i, dep)
+	}
+	wg.Wait()
+
+	return statuses
+}
+
+func (dc *dependencyChecker) cached(url string) (dependencyStatus, bool) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	st, ok := dc.cache[url]
+	if !ok || dc.clock.Now().Sub(st.CheckedAt) > dc.ttl {
+		return dependencyStatus{}, false
+	}
+	return st, true
+}
+
+func (dc *dependencyChecker) probe(dep UpstreamDependency) dependencyStatus {
+	st := dependencyStatus{
+		Name:      dep.Name,
+		URL:       dep.URL,
+		Required:  dep.Required,
+		CheckedAt: dc.clock.Now(),
+	}
+
+	resp, err := dc.client.Get(dep.URL)
+	if err != nil {
+		st.Error = err.Error()
+	} else {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 400 {
+			st.Healthy = true
+		} else {
+			st.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+		}
+	}
+
+	dc.mu.Lock()
+	dc.cache[dep.URL] = st
+	dc.mu.Unlock()
+
+	return st
+}
+
+func (h *HTTPHandler) readinessCheck(w http.ResponseWriter, r *http.Request) {
+	grpcReady := h.multiplexer.isGRPCClientReady()
+	muxServing := h.multiplexer.checkMuxServing() == nil
+	ready := h.multiplexer.Lifecycle() == LifecycleRunning && muxServing
+
+	dependencies := h.multiplexer.dependencies.check()
+	for _, dep := range dependencies {
+		if dep.Required && !dep.Healthy {
+			ready = false
+		}
+	}
+
+	draining := h.multiplexer.isDraining()
+
+	status := "ready"
+	code := http.StatusOK
+	switch {
+	case draining:
+		status = "draining"
+		code = http.StatusServiceUnavailable
+	case !ready:
+		status = "not ready"
+		code = http.StatusServiceUnavailable
+	case !grpcReady:
+		// HTTP и прокси работают, недоступен только мост /grpc-call
+		status = "degraded"
+	}
+
+	h.multiplexer.writeJSON(w, code, map[string]interface{}{
+		"status":       status,
+		"grpc_client":  grpcReady,
+		"mux_serving":  muxServing,
+		"dependencies": dependencies,
+		"timestamp":    h.multiplexer.clock.Now().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,151 @@
+package ultramux
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestHealthWatchReceivesTransitions(t *testing.T) {
+	um := newTestMultiplexer(t, DefaultConfig())
+	startTestMultiplexer(t, um)
+
+	conn, err := grpc.NewClient(um.config.Listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := healthpb.NewHealthClient(conn).Watch(ctx, &healthpb.HealthCheckRequest{Service: ""})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	recv := func(want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		if resp.Status != want {
+			t.Fatalf("status = %s, want %s", resp.Status, want)
+		}
+	}
+
+	recv(healthpb.HealthCheckResponse_SERVING)
+	um.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	recv(healthpb.HealthCheckResponse_NOT_SERVING)
+	um.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	recv(healthpb.HealthCheckResponse_SERVING)
+}
+
+func TestDependencyCheckerCachesProbes(t *testing.T) {
+	var hits atomic.Int64
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer healthy.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	dc := newDependencyChecker([]UpstreamDependency{
+		{Name: "db", URL: healthy.URL, Required: true},
+		{Name: "cache", URL: broken.URL},
+	}, 5*time.Second, clock)
+
+	statuses := dc.check()
+	if !statuses[0].Healthy || statuses[0].Name != "db" {
+		t.Fatalf("db status = %+v, want healthy", statuses[0])
+	}
+	if statuses[1].Healthy || statuses[1].Error == "" {
+		t.Fatalf("cache status = %+v, want unhealthy with an error", statuses[1])
+	}
+
+	dc.check()
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("dependency probed %d times within TTL, want 1", n)
+	}
+	clock.Advance(6 * time.Second)
+	dc.check()
+	if n := hits.Load(); n != 2 {
+		t.Fatalf("dependency probed %d times after TTL, want 2", n)
+	}
+}
+
+func TestHealthResponseConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.Health = HealthResponseConfig{
+		Fields:             map[string]interface{}{"region": "eu-1", "service": "edge"},
+		DrainingStatusCode: http.StatusServiceUnavailable,
+	}
+	um := NewUltraMultiplexer(WithConfig(config))
+	handler := newHTTPHandler(um, nil)
+
+	check := func(wantCode int, wantStatus string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		var body map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if rec.Code != wantCode || body["status"] != wantStatus {
+			t.Fatalf("status %d %v, want %d %s", rec.Code, body["status"], wantCode, wantStatus)
+		}
+		if body["region"] != "eu-1" || body["service"] != "edge" {
+			t.Fatalf("configured fields missing: %v", body)
+		}
+	}
+
+	check(http.StatusOK, "ok")
+	um.mu.Lock()
+	um.draining = true
+	um.mu.Unlock()
+	check(http.StatusServiceUnavailable, "draining")
+}
+
+func TestReadinessReportsDeadMux(t *testing.T) {
+	um := NewUltraMultiplexer()
+	um.lifecycle = LifecycleRunning
+	um.serverReady = true
+	um.muxDone = make(chan struct{})
+	um.acceptErrs = &acceptErrorListener{failed: make(chan struct{})}
+	handler := newHTTPHandler(um, nil)
+
+	check := func(wantCode int, wantStatus string, wantServing bool) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var body struct {
+			Status     string `json:"status"`
+			MuxServing bool   `json:"mux_serving"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if rec.Code != wantCode || body.Status != wantStatus || body.MuxServing != wantServing {
+			t.Fatalf("got %d %s mux_serving=%v, want %d %s mux_serving=%v",
+				rec.Code, body.Status, body.MuxServing, wantCode, wantStatus, wantServing)
+		}
+	}
+
+	check(http.StatusOK, "ready", true)
+	// Процесс жив и отвечает, но cmux больше не принимает соединения
+	um.mu.Lock()
+	close(um.muxDone)
+	um.mu.Unlock()
+	check(http.StatusServiceUnavailable, "not ready", false)
+}
@@ -0,0 +1,41 @@
+package ultramux
+
+import (
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+// runHeartbeat раз в Config.HeartbeatInterval пишет в лог сводку: аптайм,
+// число запросов, открытые соединения и состояние gRPC клиента моста.
+// Завершается при остановке мультиплексора
+func (um *UltraMultiplexer) runHeartbeat() {
+	defer um.serveWG.Done()
+
+	interval := um.config.HeartbeatInterval
+	for {
+		select {
+		case <-um.done:
+			return
+		case <-um.clock.After(interval):
+		}
+		um.logHeartbeat()
+	}
+}
+
+func (um *UltraMultiplexer) logHeartbeat() {
+	counters, _ := um.metrics.Snapshot()["counters"].(map[string]int64)
+
+	um.mu.RLock()
+	uptime := um.clock.Now().Sub(um.startedAt).Truncate(time.Second)
+	lifecycle := um.lifecycle
+	grpcState := connectivity.Shutdown
+	if um.grpcConn != nil {
+		grpcState = um.grpcConn.GetState()
+	}
+	um.mu.RUnlock()
+
+	um.logger.Printf("💓 Heartbeat: uptime=%s state=%s http_requests=%d grpc_requests=%d connections_open=%d proxy_in_flight=%d grpc_client=%s",
+		uptime, lifecycle, counters["http_requests_total"], counters["grpc_requests_total"],
+		um.openConns.Load(), um.proxyInFlight.Load(), grpcState)
+}
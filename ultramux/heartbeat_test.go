@@ -0,0 +1,52 @@
+package ultramux
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatLine(t *testing.T) {
+	var out bytes.Buffer
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	um := NewUltraMultiplexer(WithClock(clock), WithLogger(log.New(&out, "", 0)))
+	um.startedAt = clock.Now()
+	um.metrics.Inc("http_requests_total")
+	um.metrics.Inc("http_requests_total")
+	um.metrics.Inc("grpc_requests_total")
+	um.openConns.Add(4)
+
+	clock.Advance(90*time.Second + 500*time.Millisecond)
+	um.logHeartbeat()
+
+	line := out.String()
+	for _, want := range []string{"uptime=1m30s", "state=new", "http_requests=2", "grpc_requests=1", "connections_open=4", "grpc_client=SHUTDOWN"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("heartbeat %q lacks %q", line, want)
+		}
+	}
+}
+
+func TestHeartbeatStopsWithMultiplexer(t *testing.T) {
+	config := DefaultConfig()
+	config.HeartbeatInterval = time.Second
+	um := NewUltraMultiplexer(WithConfig(config), WithLogger(log.New(io.Discard, "", 0)))
+
+	um.serveWG.Add(1)
+	go um.runHeartbeat()
+	um.markStopped()
+
+	stopped := make(chan struct{})
+	go func() {
+		um.serveWG.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("heartbeat goroutine did not exit after stop")
+	}
+}
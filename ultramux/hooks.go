@@ -0,0 +1,45 @@
+package ultramux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// RegisterShutdownHook добавляет функцию очистки (пул БД, кэш и т.п.),
+// которую Shutdown вызовет после дренажа серверов. Хуки выполняются в
+// обратном порядке регистрации и вместе ограничены ShutdownTimeout.
+// Stop хуки не вызывает.
+func (um *UltraMultiplexer) RegisterShutdownHook(hook func(ctx context.Context) error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.shutdownHooks = append(um.shutdownHooks, hook)
+}
+
+// runShutdownHooks выполняет хуки LIFO и собирает их ошибки
+func (um *UltraMultiplexer) runShutdownHooks(ctx context.Context) error {
+	um.mu.Lock()
+	hooks := um.shutdownHooks
+	um.shutdownHooks = nil
+	um.mu.Unlock()
+
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	hookCtx, cancel := withOptionalTimeout(ctx, um.config.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hookCtx.Err(); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown hook #%d skipped: %w", i, err))
+			continue
+		}
+		if err := hooks[i](hookCtx); err != nil {
+			um.logger.Printf("⚠️ Shutdown hook #%d failed: %v", i, err)
+			errs = append(errs, fmt.Errorf("shutdown hook #%d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,67 @@
+package ultramux
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShutdownHooksRunLIFO(t *testing.T) {
+	um := newTestMultiplexer(t, DefaultConfig())
+	var order []int
+	hookErr := errors.New("flush failed")
+	for i := 0; i < 3; i++ {
+		um.RegisterShutdownHook(func(ctx context.Context) error {
+			order = append(order, i)
+			if i == 1 {
+				return hookErr
+			}
+			return nil
+		})
+	}
+	startErr := startTestMultiplexer(t, um)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := um.Shutdown(ctx); !errors.Is(err, hookErr) {
+		t.Fatalf("Shutdown = %v, want the hook error", err)
+	}
+	waitStartReturned(t, startErr)
+
+	if len(order) != 3 || order[0] != 2 || order[1] != 1 || order[2] != 0 {
+		t.Fatalf("hooks ran in order %v, want [2 1 0]", order)
+	}
+}
+
+func TestShutdownHooksSkippedAfterTimeout(t *testing.T) {
+	config := DefaultConfig()
+	config.ShutdownTimeout = 50 * time.Millisecond
+	um := NewUltraMultiplexer(WithConfig(config))
+
+	ran := false
+	um.RegisterShutdownHook(func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	um.RegisterShutdownHook(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	err := um.runShutdownHooks(context.Background())
+	if ran || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("earlier hook ran %v, error %v; want skipped with DeadlineExceeded", ran, err)
+	}
+}
+
+func TestStopSkipsShutdownHooks(t *testing.T) {
+	um := newTestMultiplexer(t, DefaultConfig())
+	um.RegisterShutdownHook(func(ctx context.Context) error {
+		t.Error("Stop ran a shutdown hook")
+		return nil
+	})
+	startErr := startTestMultiplexer(t, um)
+	um.Stop()
+	waitStartReturned(t, startErr)
+}
@@ -0,0 +1,49 @@
+package ultramux
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// HTTP3Config включает HTTP/3 (QUIC) на UDP рядом с TCP мультиплексором.
+// Требует TLS: используются те же сертификаты, что и на TCP порту.
+type HTTP3Config struct {
+	// Addr - UDP адрес, например ":8443"; пустой - тот же порт, что и TCP
+	Addr string
+}
+
+// setupHTTP3 открывает UDP сокет заранее, чтобы ошибка всплыла в Initialize
+func (um *UltraMultiplexer) setupHTTP3(handler http.Handler, tlsConfig *tls.Config) (net.PacketConn, error) {
+	if tlsConfig == nil {
+		return nil, fmt.Errorf("%w: HTTP/3 requires TLS", ErrTLSConfig)
+	}
+
+	addr := um.config.HTTP3.Addr
+	if addr == "" {
+		addr = ":" + um.port
+	}
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: HTTP/3: %w", ErrListen, err)
+	}
+
+	um.http3Server = &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(tlsConfig),
+	}
+	return conn, nil
+}
+
+// altSvcMiddleware объявляет HTTP/3 в ответах по TCP через Alt-Svc
+func (um *UltraMultiplexer) altSvcMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := um.http3Server.SetQUICHeaders(w.Header()); err != nil {
+			um.logger.Printf("⚠️ Failed to set Alt-Svc header: %v", err)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
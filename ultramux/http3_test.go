@@ -0,0 +1,69 @@
+package ultramux
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestHTTP3ServesWithAltSvc(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+	config := DefaultConfig()
+	config.TLS = &TLSConfig{CertFile: certFile, KeyFile: keyFile}
+	config.HTTP3 = &HTTP3Config{Addr: "127.0.0.1:0"}
+	um := newTestMultiplexer(t, config)
+	addr := um.config.Listener.Addr().String()
+	startTestMultiplexer(t, um)
+
+	// HTTP/3 сервер стартует в своей горутине: ждем, пока TCP ответы
+	// начнут объявлять его через Alt-Svc
+	tcpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	var altSvc string
+	deadline := time.Now().Add(5 * time.Second)
+	for altSvc == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("TCP responses do not advertise HTTP/3 via Alt-Svc")
+		}
+		resp, err := tcpClient.Get("https://" + addr + "/health")
+		if err != nil {
+			t.Fatalf("GET over TCP: %v", err)
+		}
+		resp.Body.Close()
+		altSvc = resp.Header.Get("Alt-Svc")
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Alt-Svc: h3=":port"; ma=2592000
+	_, rest, ok := strings.Cut(altSvc, `h3=":`)
+	port, _, _ := strings.Cut(rest, `"`)
+	if !ok || port == "" {
+		t.Fatalf("Alt-Svc = %q, want an h3 port", altSvc)
+	}
+
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	defer transport.Close()
+	resp, err := (&http.Client{Transport: transport, Timeout: 5 * time.Second}).Get("https://localhost:" + port + "/health")
+	if err != nil {
+		t.Fatalf("GET over HTTP/3: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 3 {
+		t.Fatalf("HTTP/3 response: %s %s, want 200 over HTTP/3", resp.Proto, resp.Status)
+	}
+}
+
+func TestHTTP3RequiresTLS(t *testing.T) {
+	config := DefaultConfig()
+	config.HTTP3 = &HTTP3Config{Addr: "127.0.0.1:0"}
+	um := newTestMultiplexer(t, config)
+	defer um.config.Listener.Close()
+	if err := um.Initialize(); !errors.Is(err, ErrTLSConfig) {
+		t.Fatalf("Initialize = %v, want ErrTLSConfig", err)
+	}
+}
@@ -0,0 +1,115 @@
+package ultramux
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inflightRequest - выполняющийся HTTP запрос или gRPC вызов
+type inflightRequest struct {
+	RequestID string    `json:"request_id"`
+	Protocol  string    `json:"protocol"`
+	Method    string    `json:"method,omitempty"`
+	Path      string    `json:"path"`
+	Start     time.Time `json:"started_at"`
+	ElapsedMs float64   `json:"elapsed_ms"`
+
+	cancel context.CancelFunc
+}
+
+// inflightRegistry хранит выполняющиеся запросы для /admin/inflight.
+// Клиент может прислать чужой X-Request-Id, поэтому один ID может
+// соответствовать нескольким запросам
+type inflightRegistry struct {
+	mu       sync.Mutex
+	requests map[*inflightRequest]struct{}
+}
+
+func newInflightRegistry() *inflightRegistry {
+	return &inflightRegistry{requests: make(map[*inflightRequest]struct{})}
+}
+
+// track регистрирует запрос и возвращает отменяемый контекст для него;
+// done снимает запрос с учета
+func (reg *inflightRegistry) track(ctx context.Context, entry inflightRequest) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	req := &entry
+	req.cancel = cancel
+
+	reg.mu.Lock()
+	reg.requests[req] = struct{}{}
+	reg.mu.Unlock()
+
+	return ctx, func() {
+		reg.mu.Lock()
+		delete(reg.requests, req)
+		reg.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancel отменяет контексты всех запросов с этим ID и возвращает их число
+func (reg *inflightRegistry) cancel(id string) int {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	n := 0
+	for req := range reg.requests {
+		if req.RequestID == id {
+			req.cancel()
+			n++
+		}
+	}
+	return n
+}
+
+// snapshot возвращает запросы от самых долгих к новым
+func (reg *inflightRegistry) snapshot(now time.Time) []inflightRequest {
+	reg.mu.Lock()
+	out := make([]inflightRequest, 0, len(reg.requests))
+	for req := range reg.requests {
+		entry := *req
+		entry.ElapsedMs = float64(now.Sub(entry.Start)) / float64(time.Millisecond)
+		out = append(out, entry)
+	}
+	reg.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
+
+// inflightHandler: GET - список выполняющихся запросов, DELETE ?id= - отмена
+func (h *HTTPHandler) inflightHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.multiplexer.writeJSON(w, 0, map[string]interface{}{
+			"requests": h.multiplexer.inflight.snapshot(h.multiplexer.clock.Now()),
+		})
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			h.multiplexer.writeError(w, r, http.StatusBadRequest, "id parameter required")
+			return
+		}
+		canceled := h.multiplexer.inflight.cancel(id)
+		if canceled == 0 {
+			h.multiplexer.writeError(w, r, http.StatusNotFound, "no in-flight request with this id")
+			return
+		}
+		h.multiplexer.logger.Printf("🛑 Canceled %d in-flight request(s) %s via admin API", canceled, id)
+		h.multiplexer.metrics.Add("inflight_canceled_total", int64(canceled))
+		h.multiplexer.writeJSON(w, 0, map[string]interface{}{
+			"request_id": id,
+			"canceled":   canceled,
+		})
+
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodDelete}, ", "))
+		h.multiplexer.writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,66 @@
+package ultramux
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdminInflightListsAndCancels(t *testing.T) {
+	config := DefaultConfig()
+	config.AdminToken = "secret"
+	um := NewUltraMultiplexer(WithConfig(config))
+	entered := make(chan struct{})
+	handler := um.accessLogMiddleware(newHTTPHandler(um, []Route{{
+		Path: "/slow",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			close(entered)
+			<-r.Context().Done()
+		},
+	}}))
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+		req.Header.Set(requestIDHeader, "job-1")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	<-entered
+
+	admin := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var list struct {
+		Requests []inflightRequest `json:"requests"`
+	}
+	if err := json.Unmarshal(admin(http.MethodGet, "/admin/inflight").Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	found := false
+	for _, req := range list.Requests {
+		found = found || (req.RequestID == "job-1" && req.Path == "/slow")
+	}
+	if !found {
+		t.Fatalf("in-flight list = %+v, want job-1", list.Requests)
+	}
+
+	if rec := admin(http.MethodDelete, "/admin/inflight?id=unknown"); rec.Code != http.StatusNotFound {
+		t.Fatalf("cancel unknown id = %d, want 404", rec.Code)
+	}
+	if rec := admin(http.MethodDelete, "/admin/inflight?id=job-1"); rec.Code != http.StatusOK {
+		t.Fatalf("cancel = %d, want 200", rec.Code)
+	}
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("canceled request still running")
+	}
+}
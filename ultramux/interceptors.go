@@ -0,0 +1,156 @@
+package ultramux
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func (um *UltraMultiplexer) recoveryUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = um.recoveredPanic(info.FullMethod, p)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func (um *UltraMultiplexer) recoveryStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = um.recoveredPanic(info.FullMethod, p)
+		}
+	}()
+	return handler(srv, ss)
+}
+
+func (um *UltraMultiplexer) recoveredPanic(method string, p interface{}) error {
+	um.logger.Printf("💥 Panic in %s: %v\n%s", method, p, debug.Stack())
+	um.metrics.Inc("grpc_panics_total")
+	return status.Errorf(codes.Internal, "internal error")
+}
+
+func (um *UltraMultiplexer) latencyUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := um.clock.Now()
+	id := grpcRequestID(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+
+	ctx, done := um.inflight.track(withRequestID(ctx, id), inflightRequest{
+		RequestID: id,
+		Protocol:  "gRPC",
+		Path:      info.FullMethod,
+		Start:     start,
+	})
+	defer done()
+
+	// Учет в defer: при панике стек раскручивается мимо кода после
+	// handler, а запрос все равно должен попасть в лог как Internal
+	code := codes.Internal
+	defer um.logGRPCRequest(ctx, start, id, info.FullMethod, &code)
+
+	resp, err := handler(ctx, req)
+	code = status.Code(err)
+	return resp, err
+}
+
+func (um *UltraMultiplexer) latencyStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := um.clock.Now()
+	id := grpcRequestID(ss.Context())
+	ss.SetHeader(metadata.Pairs("x-request-id", id))
+
+	ctx, done := um.inflight.track(withRequestID(ss.Context(), id), inflightRequest{
+		RequestID: id,
+		Protocol:  "gRPC",
+		Path:      info.FullMethod,
+		Start:     start,
+	})
+	defer done()
+
+	code := codes.Internal
+	defer um.logGRPCRequest(ctx, start, id, info.FullMethod, &code)
+
+	err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	code = status.Code(err)
+	return err
+}
+
+// logGRPCRequest пишет вызов в лог запросов. code читается в момент
+// выполнения defer: если обработчик запаниковал, там остается Internal -
+// тот же код, что вернет Recovery
+func (um *UltraMultiplexer) logGRPCRequest(ctx context.Context, start time.Time, id, method string, code *codes.Code) {
+	um.logRequest(requestLogEntry{
+		Time:      start,
+		Protocol:  "gRPC",
+		Path:      method,
+		Status:    code.String(),
+		RequestID: id,
+		Headers:   um.loggedHeaders(incomingMetadata(ctx)),
+	}, um.clock.Now().Sub(start))
+}
+
+// grpcClientID определяет клиента по метаданным x-api-key, а при их отсутствии по IP
+func grpcClientID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if keys := md.Get("x-api-key"); len(keys) > 0 && keys[0] != "" {
+			return "key:" + keys[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return "ip:" + clientHost(p.Addr.String())
+	}
+	return "unknown"
+}
+
+func (um *UltraMultiplexer) clientLimitUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	client := grpcClientID(ctx)
+	if !um.clientLimiter.acquire(client) {
+		return nil, status.Error(codes.ResourceExhausted, "too many in-flight requests")
+	}
+	defer um.clientLimiter.release(client)
+
+	return handler(ctx, req)
+}
+
+func (um *UltraMultiplexer) clientLimitStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	client := grpcClientID(ss.Context())
+	if !um.clientLimiter.acquire(client) {
+		return status.Error(codes.ResourceExhausted, "too many in-flight requests")
+	}
+	defer um.clientLimiter.release(client)
+
+	return handler(srv, ss)
+}
+
+// rateLimitClientID - Identity.Subject после аутентификации, иначе x-api-key или IP
+func rateLimitClientID(ctx context.Context) string {
+	if identity, ok := IdentityFromContext(ctx); ok && identity.Subject != "" {
+		return "subject:" + identity.Subject
+	}
+	return grpcClientID(ctx)
+}
+
+func (um *UltraMultiplexer) methodRateLimitError(method string) error {
+	um.metrics.Inc("grpc_rate_limited_total")
+	um.metrics.Inc("grpc_rate_limited_" + methodMetricName(method) + "_total")
+	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded for %s", method)
+}
+
+func (um *UltraMultiplexer) methodRateLimitUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !um.methodLimiter.allow(info.FullMethod, rateLimitClientID(ctx)) {
+		return nil, um.methodRateLimitError(info.FullMethod)
+	}
+	return handler(ctx, req)
+}
+
+func (um *UltraMultiplexer) methodRateLimitStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !um.methodLimiter.allow(info.FullMethod, rateLimitClientID(ss.Context())) {
+		return um.methodRateLimitError(info.FullMethod)
+	}
+	return handler(srv, ss)
+}
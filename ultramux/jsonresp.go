@@ -0,0 +1,29 @@
+package ultramux
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// JSONConfig управляет кодированием JSON ответов всех встроенных эндпоинтов
+type JSONConfig struct {
+	// Indent включает форматирование ответов (например, "  " в debug режиме)
+	Indent string
+	// NoEscapeHTML отключает экранирование <, > и & в строках
+	NoEscapeHTML bool
+}
+
+// writeJSON отдает v как JSON с заданным статусом (0 - не менять статус)
+func (um *UltraMultiplexer) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if status != 0 {
+		w.WriteHeader(status)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", um.config.JSON.Indent)
+	enc.SetEscapeHTML(!um.config.JSON.NoEscapeHTML)
+	if err := enc.Encode(v); err != nil {
+		um.logger.Printf("⚠️ Failed to encode JSON response: %v", err)
+	}
+}
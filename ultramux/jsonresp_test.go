@@ -0,0 +1,35 @@
+package ultramux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteJSONOptions(t *testing.T) {
+	value := map[string]string{"html": "<b>&</b>"}
+
+	tests := []struct {
+		name   string
+		config JSONConfig
+		want   string
+	}{
+		{"default escapes HTML", JSONConfig{}, `{"html":"\u003cb\u003e\u0026\u003c/b\u003e"}` + "\n"},
+		{"no escape", JSONConfig{NoEscapeHTML: true}, `{"html":"<b>&</b>"}` + "\n"},
+		{"indent", JSONConfig{Indent: "  ", NoEscapeHTML: true}, "{\n  \"html\": \"<b>&</b>\"\n}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.JSON = tt.config
+			rec := httptest.NewRecorder()
+			NewUltraMultiplexer(WithConfig(config)).writeJSON(rec, http.StatusTeapot, value)
+			if rec.Code != http.StatusTeapot || rec.Header().Get("Content-Type") != "application/json" {
+				t.Fatalf("got %d %q, want 418 application/json", rec.Code, rec.Header().Get("Content-Type"))
+			}
+			if rec.Body.String() != tt.want {
+				t.Fatalf("body = %q, want %q", rec.Body, tt.want)
+			}
+		})
+	}
+}
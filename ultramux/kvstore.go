@@ -0,0 +1,211 @@
+package ultramux
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "ultramultiplexer/pb/pb"
+)
+
+// KVConfig настраивает хранилище Set/Get/Delete UltraService
+type KVConfig struct {
+	// MaxKeys ограничивает число ключей; Set нового ключа сверх лимита
+	// получает ResourceExhausted. 0 - без ограничений
+	MaxKeys int
+	// MaxValueBytes ограничивает размер значения; 0 - без ограничений
+	MaxValueBytes int
+	// DefaultTTL - время жизни ключа, если клиент не указал ttl_seconds.
+	// 0 - ключи бессрочные
+	DefaultTTL time.Duration
+	// SweepInterval - период фоновой очистки просроченных ключей, которые
+	// больше никто не читает; 0 - раз в минуту
+	SweepInterval time.Duration
+}
+
+type kvEntry struct {
+	value   string
+	expires time.Time // нулевое - бессрочно
+}
+
+// kvStore - map под мьютексом; просроченные ключи удаляются при обращении,
+// при Set сверх MaxKeys и фоновой очисткой (runKVSweeper)
+type kvStore struct {
+	cfg   KVConfig
+	clock Clock
+
+	mu      sync.Mutex
+	entries map[string]kvEntry
+}
+
+func newKVStore(cfg KVConfig, clock Clock) *kvStore {
+	return &kvStore{cfg: cfg, clock: clock, entries: make(map[string]kvEntry)}
+}
+
+func (e kvEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+func (s *kvStore) set(key, value string, ttl time.Duration) error {
+	now := s.clock.Now()
+	if ttl <= 0 {
+		ttl = s.cfg.DefaultTTL
+	}
+	entry := kvEntry{value: value}
+	if ttl > 0 {
+		entry.expires = now.Add(ttl)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.entries[key]; !exists && s.cfg.MaxKeys > 0 && len(s.entries) >= s.cfg.MaxKeys {
+		s.sweepLocked(now)
+		if len(s.entries) >= s.cfg.MaxKeys {
+			return status.Errorf(codes.ResourceExhausted, "key limit %d reached", s.cfg.MaxKeys)
+		}
+	}
+	s.entries[key] = entry
+	return nil
+}
+
+func (s *kvStore) get(key string) (kvEntry, bool) {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if ok && entry.expired(now) {
+		delete(s.entries, key)
+		return kvEntry{}, false
+	}
+	return entry, ok
+}
+
+func (s *kvStore) delete(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	delete(s.entries, key)
+	return ok && !entry.expired(s.clock.Now())
+}
+
+// sweep удаляет все просроченные ключи и возвращает их число
+func (s *kvStore) sweep() int {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sweepLocked(now)
+}
+
+func (s *kvStore) sweepLocked(now time.Time) int {
+	removed := 0
+	for k, e := range s.entries {
+		if e.expired(now) {
+			delete(s.entries, k)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (s *kvStore) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// runKVSweeper периодически чистит просроченные ключи: без этого ключи с
+// TTL, которые больше не читают, копились бы бесконечно. Завершается при
+// остановке мультиплексора
+func (um *UltraMultiplexer) runKVSweeper() {
+	defer um.serveWG.Done()
+
+	interval := um.config.KV.SweepInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	for {
+		select {
+		case <-um.done:
+			return
+		case <-um.clock.After(interval):
+		}
+		if removed := um.kv.sweep(); removed > 0 {
+			um.metrics.Add("kv_expired_total", int64(removed))
+		}
+	}
+}
+
+var keyViolation = &errdetails.BadRequest_FieldViolation{
+	Field:       "key",
+	Description: "must not be empty",
+}
+
+func validateKey(key string) error {
+	if key == "" {
+		return invalidArgument(keyViolation)
+	}
+	return nil
+}
+
+func (s *GRPCServer) Set(ctx context.Context, req *pb.SetRequest) (*pb.SetReply, error) {
+	var violations []*errdetails.BadRequest_FieldViolation
+	if req.Key == "" {
+		violations = append(violations, keyViolation)
+	}
+	if limit := s.multiplexer.config.KV.MaxValueBytes; limit > 0 && len(req.Value) > limit {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       "value",
+			Description: fmt.Sprintf("must be at most %d bytes, got %d", limit, len(req.Value)),
+		})
+	}
+	if req.TtlSeconds < 0 {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       "ttl_seconds",
+			Description: "must not be negative",
+		})
+	}
+	if len(violations) > 0 {
+		return nil, invalidArgument(violations...)
+	}
+
+	ttl := time.Duration(req.TtlSeconds) * time.Second
+	if err := s.multiplexer.kv.set(req.Key, req.Value, ttl); err != nil {
+		return nil, err
+	}
+	return &pb.SetReply{}, nil
+}
+
+func (s *GRPCServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetReply, error) {
+	if err := validateKey(req.Key); err != nil {
+		return nil, err
+	}
+	entry, ok := s.multiplexer.kv.get(req.Key)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "key %q not found", req.Key)
+	}
+
+	reply := &pb.GetReply{Value: entry.value}
+	if !entry.expires.IsZero() {
+		// Округляем вверх, чтобы живой ключ не выглядел бессрочным
+		remaining := entry.expires.Sub(s.multiplexer.clock.Now())
+		reply.TtlSeconds = int64((remaining + time.Second - 1) / time.Second)
+	}
+	return reply, nil
+}
+
+func (s *GRPCServer) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteReply, error) {
+	if err := validateKey(req.Key); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteReply{Deleted: s.multiplexer.kv.delete(req.Key)}, nil
+}
@@ -0,0 +1,54 @@
+package ultramux
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock - часы, которые двигает тест
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) Sleep(d time.Duration) { c.Advance(d) }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.Advance(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
+
+func TestKVSweepRemovesUnreadExpiredKeys(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	kv := newKVStore(KVConfig{}, clock)
+
+	kv.set("short", "a", time.Second)
+	kv.set("long", "b", time.Hour)
+	kv.set("forever", "c", 0)
+
+	clock.Advance(time.Minute)
+	if removed := kv.sweep(); removed != 1 {
+		t.Fatalf("sweep removed %d keys, want 1", removed)
+	}
+	if n := kv.len(); n != 2 {
+		t.Fatalf("len = %d, want 2", n)
+	}
+	if _, ok := kv.get("long"); !ok {
+		t.Fatal("unexpired key removed")
+	}
+}
@@ -0,0 +1,85 @@
+package ultramux
+
+import "fmt"
+
+// LifecycleState - стадия жизненного цикла мультиплексора. Переходы:
+//
+//	New -> Initializing -> Initialized -> Starting -> Running -> Stopping -> Stopped
+//
+// Неудачный Initialize возвращает в New. Stop/Shutdown допустимы из любой
+// стадии и идемпотентны (во время Initializing они дожидаются его конца);
+// остальные переходы вне порядка отклоняются с ErrInvalidTransition.
+type LifecycleState int
+
+const (
+	LifecycleNew LifecycleState = iota
+	LifecycleInitializing
+	LifecycleInitialized
+	LifecycleStarting
+	LifecycleRunning
+	LifecycleStopping
+	LifecycleStopped
+)
+
+func (s LifecycleState) String() string {
+	switch s {
+	case LifecycleNew:
+		return "new"
+	case LifecycleInitializing:
+		return "initializing"
+	case LifecycleInitialized:
+		return "initialized"
+	case LifecycleStarting:
+		return "starting"
+	case LifecycleRunning:
+		return "running"
+	case LifecycleStopping:
+		return "stopping"
+	case LifecycleStopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("LifecycleState(%d)", int(s))
+	}
+}
+
+// Lifecycle возвращает текущую стадию жизненного цикла
+func (um *UltraMultiplexer) Lifecycle() LifecycleState {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+	return um.lifecycle
+}
+
+// transition переводит мультиплексор в to, если текущая стадия - from
+func (um *UltraMultiplexer) transition(from, to LifecycleState) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	if um.lifecycle != from {
+		return fmt.Errorf("%w: cannot move to %s from %s", ErrInvalidTransition, to, um.lifecycle)
+	}
+	um.lifecycle = to
+	return nil
+}
+
+// beginStop переводит в Stopping; false - остановка уже идет или завершена.
+// Идущий Initialize сначала дорабатывает: иначе его листенер и Serve
+// горутины остались бы никем не остановленными
+func (um *UltraMultiplexer) beginStop() bool {
+	um.initMu.Lock()
+	defer um.initMu.Unlock()
+
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	if um.lifecycle >= LifecycleStopping {
+		return false
+	}
+	um.lifecycle = LifecycleStopping
+	return true
+}
+
+func (um *UltraMultiplexer) stopping() bool {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+	return um.lifecycle >= LifecycleStopping
+}
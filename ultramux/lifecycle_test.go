@@ -0,0 +1,39 @@
+package ultramux
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLifecycleRejectsOutOfOrderCalls(t *testing.T) {
+	um := newTestMultiplexer(t, DefaultConfig())
+
+	if err := um.Start(); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("Start before Initialize = %v, want ErrInvalidTransition", err)
+	}
+	if err := um.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if err := um.Initialize(); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("second Initialize = %v, want ErrInvalidTransition", err)
+	}
+	if got := um.Lifecycle(); got != LifecycleInitialized {
+		t.Fatalf("lifecycle = %s, want initialized", got)
+	}
+
+	if err := um.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if err := um.Stop(); err != nil {
+		t.Fatalf("second Stop: %v", err)
+	}
+	if err := um.Start(); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("Start after Stop = %v, want ErrInvalidTransition", err)
+	}
+	if err := um.Initialize(); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("Initialize after Stop = %v, want ErrInvalidTransition", err)
+	}
+	if got := um.Lifecycle(); got != LifecycleStopped {
+		t.Fatalf("lifecycle = %s, want stopped", got)
+	}
+}
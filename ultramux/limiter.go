@@ -0,0 +1,58 @@
+package ultramux
+
+import (
+	"net"
+	"sync"
+)
+
+// clientLimiter ограничивает число одновременных запросов от одного клиента
+type clientLimiter struct {
+	mu       sync.Mutex
+	limit    int
+	inFlight map[string]int
+}
+
+func newClientLimiter(limit int) *clientLimiter {
+	return &clientLimiter{
+		limit:    limit,
+		inFlight: make(map[string]int),
+	}
+}
+
+func (l *clientLimiter) acquire(client string) bool {
+	if l.limit <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inFlight[client] >= l.limit {
+		return false
+	}
+	l.inFlight[client]++
+	return true
+}
+
+func (l *clientLimiter) release(client string) {
+	if l.limit <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight[client]--
+	if l.inFlight[client] <= 0 {
+		delete(l.inFlight, client)
+	}
+}
+
+// clientHost отбрасывает порт из адреса клиента
+func clientHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
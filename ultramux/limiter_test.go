@@ -0,0 +1,63 @@
+package ultramux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientLimiterPerClient(t *testing.T) {
+	l := newClientLimiter(2)
+	if !l.acquire("a") || !l.acquire("a") {
+		t.Fatal("first two requests of a rejected")
+	}
+	if l.acquire("a") {
+		t.Fatal("third concurrent request of a accepted")
+	}
+	if !l.acquire("b") {
+		t.Fatal("client b limited by a's requests")
+	}
+	l.release("a")
+	if !l.acquire("a") {
+		t.Fatal("slot of a not freed by release")
+	}
+}
+
+func TestClientLimitMiddleware(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxInFlightPerClient = 1
+	um := NewUltraMultiplexer(WithConfig(config))
+
+	// Обработчик проверяет лимит изнутри первого запроса клиента
+	var inner *httptest.ResponseRecorder
+	var handler http.Handler
+	handler = um.clientLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inner != nil {
+			return
+		}
+		inner = httptest.NewRecorder()
+		same := httptest.NewRequest(http.MethodGet, "/x", nil)
+		same.RemoteAddr = r.RemoteAddr
+		handler.ServeHTTP(inner, same)
+
+		other := httptest.NewRequest(http.MethodGet, "/x", nil)
+		other.RemoteAddr = r.RemoteAddr
+		other.Header.Set("X-API-Key", "k")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, other)
+		if rec.Code != http.StatusOK {
+			t.Errorf("request with its own API key: status %d, want 200", rec.Code)
+		}
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/x", nil))
+	if inner.Code != http.StatusTooManyRequests {
+		t.Fatalf("concurrent request from the same client: status %d, want 429", inner.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("request after release: status %d, want 200", rec.Code)
+	}
+}
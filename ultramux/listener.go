@@ -0,0 +1,98 @@
+package ultramux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// listen открывает TCP listener на um.port. Если порт занят и задан
+// PortRetries, пробует следующие порты и запоминает фактически занятый.
+func (um *UltraMultiplexer) listen() (net.Listener, error) {
+	port := um.port
+	lc := net.ListenConfig{Control: um.listenControl}
+	for attempt := 0; ; attempt++ {
+		listener, err := lc.Listen(context.Background(), "tcp", ":"+port)
+		if err == nil {
+			if err := um.applyBacklog(listener); err != nil {
+				listener.Close()
+				return nil, err
+			}
+			if port != um.port {
+				um.logger.Printf("⚠️ Port %s is in use, listening on %s instead", um.port, port)
+				um.port = port
+			}
+			return listener, nil
+		}
+
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, fmt.Errorf("%w: %w", ErrListen, err)
+		}
+
+		next, convErr := strconv.Atoi(port)
+		if attempt >= um.config.PortRetries || convErr != nil {
+			return nil, fmt.Errorf("%w (%w): %w", ErrListen, ErrPortInUse, err)
+		}
+		port = strconv.Itoa(next + 1)
+	}
+}
+
+// listenControl выставляет опции сокета до bind
+func (um *UltraMultiplexer) listenControl(network, address string, c syscall.RawConn) error {
+	if !um.config.ReusePort {
+		return nil
+	}
+	var sockErr error
+	if err := c.Control(func(fd uintptr) { sockErr = setReusePort(fd) }); err != nil {
+		return err
+	}
+	if sockErr != nil {
+		return fmt.Errorf("%w: SO_REUSEPORT: %w", ErrInvalidConfig, sockErr)
+	}
+	return nil
+}
+
+// applyBacklog меняет очередь после listen: Control вызывается до bind,
+// а длину очереди задает сам listen
+func (um *UltraMultiplexer) applyBacklog(listener net.Listener) error {
+	if um.config.ListenBacklog <= 0 {
+		return nil
+	}
+	tcp, ok := listener.(*net.TCPListener)
+	if !ok {
+		return nil
+	}
+	raw, err := tcp.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrListen, err)
+	}
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) { sockErr = setBacklog(fd, um.config.ListenBacklog) }); err != nil {
+		return fmt.Errorf("%w: %w", ErrListen, err)
+	}
+	if sockErr != nil {
+		return fmt.Errorf("%w: listen backlog %d: %w", ErrInvalidConfig, um.config.ListenBacklog, sockErr)
+	}
+	return nil
+}
+
+// fileListener берет унаследованный от init системы сокет по номеру
+// дескриптора (socket activation передает их начиная с 3)
+func fileListener(fd int) (net.Listener, error) {
+	f := os.NewFile(uintptr(fd), "listen-fd-"+strconv.Itoa(fd))
+	if f == nil {
+		return nil, fmt.Errorf("%w: invalid file descriptor %d", ErrListen, fd)
+	}
+	// FileListener дублирует дескриптор, исходный файл больше не нужен
+	defer f.Close()
+
+	listener, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: fd %d: %w", ErrListen, fd, err)
+	}
+	return listener, nil
+}
@@ -0,0 +1,50 @@
+package ultramux
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestFileListener(t *testing.T) {
+	inherited, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer inherited.Close()
+	raw, err := inherited.(*net.TCPListener).SyscallConn()
+	if err != nil {
+		t.Fatalf("SyscallConn: %v", err)
+	}
+	// fileListener забирает дескриптор себе, поэтому отдаем ему копию
+	fd := -1
+	raw.Control(func(s uintptr) { fd, err = syscall.Dup(int(s)) })
+	if err != nil {
+		t.Fatalf("dup: %v", err)
+	}
+
+	listener, err := fileListener(fd)
+	if err != nil {
+		t.Fatalf("fileListener: %v", err)
+	}
+	defer listener.Close()
+	if listener.Addr().String() != inherited.Addr().String() {
+		t.Fatalf("listener on %s, want inherited %s", listener.Addr(), inherited.Addr())
+	}
+
+	// Дескриптор обычного файла - ошибка ErrListen
+	f, err := os.CreateTemp(t.TempDir(), "not-a-socket")
+	if err != nil {
+		t.Fatalf("create temp: %v", err)
+	}
+	defer f.Close()
+	fileFD, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatalf("dup: %v", err)
+	}
+	if _, err := fileListener(fileFD); !errors.Is(err, ErrListen) {
+		t.Fatalf("fileListener(regular file) = %v, want ErrListen", err)
+	}
+}
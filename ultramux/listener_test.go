@@ -0,0 +1,35 @@
+package ultramux
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestListenPortRetries(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer busy.Close()
+	_, port, _ := net.SplitHostPort(busy.Addr().String())
+
+	um := NewUltraMultiplexerWithConfig(port, DefaultConfig())
+	if _, err := um.listen(); !errors.Is(err, ErrPortInUse) {
+		t.Fatalf("listen without retries = %v, want ErrPortInUse", err)
+	}
+
+	config := DefaultConfig()
+	config.PortRetries = 10
+	um = NewUltraMultiplexerWithConfig(port, config)
+	listener, err := um.listen()
+	if err != nil {
+		t.Fatalf("listen with retries: %v", err)
+	}
+	defer listener.Close()
+
+	_, got, _ := net.SplitHostPort(listener.Addr().String())
+	if got == port || um.port != got {
+		t.Fatalf("listening on %s (um.port %s), busy port %s", got, um.port, port)
+	}
+}
@@ -0,0 +1,191 @@
+package ultramux
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics - простой реестр счетчиков, gauge'ей и гистограмм, отдается через /metrics в JSON
+type Metrics struct {
+	mu         sync.RWMutex
+	counters   map[string]*int64
+	gauges     map[string]func() float64
+	histograms map[string]*histogram
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{
+		counters:   make(map[string]*int64),
+		gauges:     make(map[string]func() float64),
+		histograms: make(map[string]*histogram),
+	}
+}
+
+// histogramBuckets - верхние границы бакетов длительностей
+var histogramBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+type histogram struct {
+	mu      sync.Mutex
+	count   int64
+	sum     time.Duration
+	buckets []int64 // последний бакет - +Inf
+}
+
+func (h *histogram) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.count++
+	h.sum += d
+	i := sort.Search(len(histogramBuckets), func(i int) bool { return d <= histogramBuckets[i] })
+	h.buckets[i]++
+}
+
+func (h *histogram) snapshot() map[string]interface{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Кумулятивные бакеты, как в Prometheus
+	buckets := make(map[string]int64, len(h.buckets))
+	var cumulative int64
+	for i, n := range h.buckets {
+		cumulative += n
+		le := "+Inf"
+		if i < len(histogramBuckets) {
+			le = histogramBuckets[i].String()
+		}
+		buckets[le] = cumulative
+	}
+
+	return map[string]interface{}{
+		"count":   h.count,
+		"sum_ms":  float64(h.sum) / float64(time.Millisecond),
+		"buckets": buckets,
+	}
+}
+
+// Observe добавляет длительность в гистограмму name
+func (m *Metrics) Observe(name string, d time.Duration) {
+	m.mu.RLock()
+	h, ok := m.histograms[name]
+	m.mu.RUnlock()
+
+	if !ok {
+		m.mu.Lock()
+		if h, ok = m.histograms[name]; !ok {
+			h = &histogram{buckets: make([]int64, len(histogramBuckets)+1)}
+			m.histograms[name] = h
+		}
+		m.mu.Unlock()
+	}
+	h.observe(d)
+}
+
+func (m *Metrics) counter(name string) *int64 {
+	m.mu.RLock()
+	c, ok := m.counters[name]
+	m.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok = m.counters[name]; !ok {
+		c = new(int64)
+		m.counters[name] = c
+	}
+	return c
+}
+
+// Add увеличивает счетчик name на delta
+func (m *Metrics) Add(name string, delta int64) {
+	atomic.AddInt64(m.counter(name), delta)
+}
+
+// Inc увеличивает счетчик name на единицу
+func (m *Metrics) Inc(name string) {
+	m.Add(name, 1)
+}
+
+// Gauge регистрирует функцию, значение которой снимается при каждом запросе /metrics
+func (m *Metrics) Gauge(name string, fn func() float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges[name] = fn
+}
+
+// Snapshot возвращает текущие значения всех метрик
+func (m *Metrics) Snapshot() map[string]interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counters := make(map[string]int64, len(m.counters))
+	for name, c := range m.counters {
+		counters[name] = atomic.LoadInt64(c)
+	}
+	gauges := make(map[string]float64, len(m.gauges))
+	for name, fn := range m.gauges {
+		gauges[name] = fn()
+	}
+
+	histograms := make(map[string]interface{}, len(m.histograms))
+	for name, h := range m.histograms {
+		histograms[name] = h.snapshot()
+	}
+
+	return map[string]interface{}{
+		"counters":   counters,
+		"gauges":     gauges,
+		"histograms": histograms,
+	}
+}
+
+func (h *HTTPHandler) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	h.multiplexer.writeJSON(w, 0, h.multiplexer.metrics.Snapshot())
+}
+
+// statsHandler сводит счетчики соединений и трафика по протоколам
+func (h *HTTPHandler) statsHandler(w http.ResponseWriter, r *http.Request) {
+	type protocolStats struct {
+		Connections int64 `json:"connections"`
+		BytesIn     int64 `json:"bytes_in"`
+		BytesOut    int64 `json:"bytes_out"`
+	}
+
+	stats := make(map[string]*protocolStats)
+	get := func(protocol string) *protocolStats {
+		if stats[protocol] == nil {
+			stats[protocol] = &protocolStats{}
+		}
+		return stats[protocol]
+	}
+
+	counters, _ := h.multiplexer.metrics.Snapshot()["counters"].(map[string]int64)
+	for name, n := range counters {
+		if protocol, ok := counterProtocol(name, "bytes_in_"); ok {
+			get(protocol).BytesIn = n
+		} else if protocol, ok := counterProtocol(name, "bytes_out_"); ok {
+			get(protocol).BytesOut = n
+		} else if protocol, ok := counterProtocol(name, "cmux_connections_"); ok {
+			get(protocol).Connections = n
+		}
+	}
+	h.multiplexer.writeJSON(w, 0, map[string]interface{}{"protocols": stats})
+}
+
+// counterProtocol извлекает протокол из имени счетчика <prefix><proto>_total
+func counterProtocol(name, prefix string) (string, bool) {
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, "_total") {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(name, prefix), "_total"), true
+}
@@ -0,0 +1,154 @@
+package ultramux
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statusRecorder запоминает код ответа и количество записанных байт
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap нужен для http.ResponseController
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+func (rec *statusRecorder) statusCode() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+func (um *UltraMultiplexer) accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := um.clock.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		id := httpRequestID(r)
+		w.Header().Set(requestIDHeader, id)
+		ctx, done := um.inflight.track(withRequestID(r.Context(), id), inflightRequest{
+			RequestID: id,
+			Protocol:  "HTTP",
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Start:     start,
+		})
+		defer done()
+		r = r.WithContext(ctx)
+
+		// В defer: http.ErrAbortHandler и другие паники обработчика тоже
+		// попадают в access-лог и /admin/requests, затем паника идет дальше
+		defer func() {
+			p := recover()
+			status := strconv.Itoa(rec.statusCode())
+			if p != nil && rec.status == 0 {
+				status = "-" // соединение оборвано до ответа
+			}
+			um.logRequest(requestLogEntry{
+				Time:      start,
+				Protocol:  "HTTP",
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Status:    status,
+				RequestID: id,
+				Headers:   um.loggedHeaders(r.Header.Values),
+				Aborted:   p != nil,
+			}, um.clock.Now().Sub(start))
+			if p != nil {
+				panic(p)
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// logRequest пишет access-лог с учетом порога медленных запросов и
+// сохраняет запрос в кольцевой буфер /admin/requests
+func (um *UltraMultiplexer) logRequest(entry requestLogEntry, duration time.Duration) {
+	entry.DurationMs = float64(duration) / float64(time.Millisecond)
+	um.requestLog.add(entry)
+	um.metrics.Inc(strings.ToLower(entry.Protocol) + "_requests_total")
+
+	protocol, status := entry.Protocol, entry.Status
+	if entry.Aborted {
+		status += " (aborted)"
+	}
+	target := entry.Path
+	if entry.Method != "" {
+		target = entry.Method + " " + target
+	}
+	if len(entry.Headers) > 0 {
+		keys := make([]string, 0, len(entry.Headers))
+		for key := range entry.Headers {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			target += " " + key + "=" + strconv.Quote(entry.Headers[key])
+		}
+	}
+
+	threshold := um.config.SlowRequestThreshold
+	if threshold > 0 {
+		if duration > threshold {
+			um.logger.Printf("⚠️ Slow %s request: %s -> %s took %v (threshold %v)", protocol, target, status, duration, threshold)
+		}
+		return
+	}
+
+	if um.config.AccessLog {
+		um.logger.Printf("📥 %s %s -> %s (%v)", protocol, target, status, duration)
+	}
+}
+
+// httpClientID определяет клиента по API ключу, а при его отсутствии по IP
+func httpClientID(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return "key:" + key
+	}
+	return "ip:" + clientHost(r.RemoteAddr)
+}
+
+func (um *UltraMultiplexer) clientLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := httpClientID(r)
+		if !um.clientLimiter.acquire(client) {
+			um.writeError(w, r, http.StatusTooManyRequests, "too many in-flight requests")
+			return
+		}
+		defer um.clientLimiter.release(client)
+
+		next.ServeHTTP(w, r)
+	})
+}
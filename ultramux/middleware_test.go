@@ -0,0 +1,44 @@
+package ultramux
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowRequestThresholdLogsOnlySlowRequests(t *testing.T) {
+	var out bytes.Buffer
+	config := DefaultConfig()
+	config.AccessLog = true
+	config.SlowRequestThreshold = 100 * time.Millisecond
+	um := NewUltraMultiplexer(WithConfig(config), WithLogger(log.New(&out, "", 0)))
+
+	um.logRequest(requestLogEntry{Protocol: "HTTP", Method: "GET", Path: "/fast", Status: "200"}, 10*time.Millisecond)
+	um.logRequest(requestLogEntry{Protocol: "HTTP", Method: "GET", Path: "/slow", Status: "200"}, 300*time.Millisecond)
+
+	logged := out.String()
+	if strings.Contains(logged, "/fast") {
+		t.Errorf("fast request logged despite the threshold:\n%s", logged)
+	}
+	if !strings.Contains(logged, "Slow HTTP request: GET /slow") {
+		t.Errorf("slow request not logged:\n%s", logged)
+	}
+	// В кольцевой буфер попадают все запросы
+	if n := len(um.requestLog.snapshot()); n != 2 {
+		t.Errorf("request ring has %d entries, want 2", n)
+	}
+}
+
+func TestAccessLogWithoutThreshold(t *testing.T) {
+	var out bytes.Buffer
+	config := DefaultConfig()
+	config.AccessLog = true
+	um := NewUltraMultiplexer(WithConfig(config), WithLogger(log.New(&out, "", 0)))
+
+	um.logRequest(requestLogEntry{Protocol: "gRPC", Path: "/pkg.Service/Method", Status: "OK"}, time.Millisecond)
+	if !strings.Contains(out.String(), "gRPC /pkg.Service/Method -> OK") {
+		t.Errorf("access log line missing:\n%s", out.String())
+	}
+}
@@ -0,0 +1,113 @@
+package ultramux
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// MessageSizeLimit - лимиты размера сериализованных сообщений в байтах; 0 - без лимита
+type MessageSizeLimit struct {
+	Request  int
+	Response int
+}
+
+// MessageSizeConfig задает прикладные лимиты размера сообщений поверх
+// транспортного MaxRecvMsgSize: отказ приходит с понятной ошибкой и
+// попадает в метрики метода
+type MessageSizeConfig struct {
+	// Default применяется к методам, которых нет в Methods
+	Default MessageSizeLimit
+	// Methods - лимиты по полному имени метода, например "/pb.UltraService/ProcessData"
+	Methods map[string]MessageSizeLimit
+}
+
+func (c MessageSizeConfig) enabled() bool {
+	return c.Default != (MessageSizeLimit{}) || len(c.Methods) > 0
+}
+
+func (c MessageSizeConfig) limitFor(method string) MessageSizeLimit {
+	if limit, ok := c.Methods[method]; ok {
+		return limit
+	}
+	return c.Default
+}
+
+// methodMetricName: "/pb.UltraService/ProcessData" -> "pb.UltraService.ProcessData"
+func methodMetricName(method string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(method, "/"), "/", ".")
+}
+
+// checkMessageSize сверяет размер сообщения с лимитом; kind - "request" или "response"
+func (um *UltraMultiplexer) checkMessageSize(method, kind string, msg interface{}, limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return nil
+	}
+	size := proto.Size(m)
+	if size <= limit {
+		return nil
+	}
+
+	um.metrics.Inc("grpc_" + kind + "_too_large_total")
+	um.metrics.Inc("grpc_" + kind + "_too_large_" + methodMetricName(method) + "_total")
+	msgText := fmt.Sprintf("%s message is %d bytes, limit for %s is %d", kind, size, method, limit)
+	if kind == "response" {
+		return status.Error(codes.ResourceExhausted, msgText)
+	}
+	return status.Error(codes.InvalidArgument, msgText)
+}
+
+func (um *UltraMultiplexer) messageSizeUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	limit := um.config.GRPCMessageSize.limitFor(info.FullMethod)
+	if err := um.checkMessageSize(info.FullMethod, "request", req, limit.Request); err != nil {
+		return nil, err
+	}
+
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	if err := um.checkMessageSize(info.FullMethod, "response", resp, limit.Response); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (um *UltraMultiplexer) messageSizeStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	limit := um.config.GRPCMessageSize.limitFor(info.FullMethod)
+	if limit == (MessageSizeLimit{}) {
+		return handler(srv, ss)
+	}
+	return handler(srv, &sizeLimitedStream{ServerStream: ss, um: um, method: info.FullMethod, limit: limit})
+}
+
+// sizeLimitedStream проверяет каждое сообщение стрима
+type sizeLimitedStream struct {
+	grpc.ServerStream
+	um     *UltraMultiplexer
+	method string
+	limit  MessageSizeLimit
+}
+
+func (s *sizeLimitedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.um.checkMessageSize(s.method, "request", m, s.limit.Request)
+}
+
+func (s *sizeLimitedStream) SendMsg(m interface{}) error {
+	if err := s.um.checkMessageSize(s.method, "response", m, s.limit.Response); err != nil {
+		return err
+	}
+	return s.ServerStream.SendMsg(m)
+}
@@ -0,0 +1,56 @@
+package ultramux
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestMessageSizeUnaryInterceptor(t *testing.T) {
+	config := DefaultConfig()
+	config.GRPCMessageSize = MessageSizeConfig{
+		Default: MessageSizeLimit{Request: 64, Response: 64},
+		Methods: map[string]MessageSizeLimit{"/pkg.Svc/Big": {Request: 1024}},
+	}
+	um := NewUltraMultiplexer(WithConfig(config))
+
+	tests := []struct {
+		name     string
+		method   string
+		request  int
+		response int
+		want     codes.Code
+	}{
+		{"within limits", "/pkg.Svc/Small", 10, 10, codes.OK},
+		{"request too large", "/pkg.Svc/Small", 100, 10, codes.InvalidArgument},
+		{"response too large", "/pkg.Svc/Small", 10, 100, codes.ResourceExhausted},
+		{"method override", "/pkg.Svc/Big", 500, 500, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+				return wrapperspb.String(strings.Repeat("r", tt.response)), nil
+			}
+			req := wrapperspb.String(strings.Repeat("q", tt.request))
+			_, err := um.messageSizeUnaryInterceptor(context.Background(), req, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if status.Code(err) != tt.want {
+				t.Fatalf("code = %s, want %s", status.Code(err), tt.want)
+			}
+			if tt.want == codes.InvalidArgument && called {
+				t.Fatal("handler called for an oversized request")
+			}
+		})
+	}
+
+	counters, _ := um.metrics.Snapshot()["counters"].(map[string]int64)
+	if counters["grpc_request_too_large_pkg.Svc.Small_total"] != 1 || counters["grpc_response_too_large_total"] != 1 {
+		t.Fatalf("counters = %v", counters)
+	}
+}
@@ -0,0 +1,1172 @@
+// Package ultramux - мультиплексор HTTP/1.1 и gRPC на одном порту.
+// Пакет можно встраивать в собственный бинарник: дополнительные gRPC сервисы
+// регистрируются через RegisterGRPCService, HTTP эндпоинты - через RegisterRoute.
+package ultramux
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/soheilhy/cmux"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+
+	pb "ultramultiplexer/pb/pb"
+)
+
+// UltraMultiplexer принимает HTTP и gRPC на одном порту через cmux и
+// содержит встроенные HTTP и gRPC клиенты
+type UltraMultiplexer struct {
+	port        string
+	config      Config
+	clock       Clock
+	listener    net.Listener
+	acceptErrs  *acceptErrorListener
+	mux         cmux.CMux
+	httpServer  *http.Server
+	http3Server *http3.Server
+	grpcServer  *grpc.Server
+	healthSrv   *health.Server
+
+	grpcRegistrations    []func(*grpc.Server)
+	shutdownHooks        []func(context.Context) error
+	responseTransformers []responseTransformer
+	customMatchers       []customMatcher
+	unaryInterceptors    []stagedUnaryInterceptor
+	streamInterceptors   []stagedStreamInterceptor
+	httpRoutes           []Route
+	httpHandler          *HTTPHandler
+
+	logger          *log.Logger
+	httpClient      *http.Client
+	readinessClient *http.Client
+	clientLimiter   *clientLimiter
+	methodLimiter   *methodRateLimiter // nil - без лимитов по методам
+	handlerPool     *handlerPool
+	dependencies    *dependencyChecker
+	retryBudget     *retryBudget
+	bodyLogLimiter  *tokenBucket
+	metrics         *Metrics
+	requestLog      *requestRing
+	inflight        *inflightRegistry
+	kv              *kvStore
+	flags           *featureFlags
+	errorPage       *template.Template
+	rewriteCache    sync.Map // скомпилированные шаблоны PathRewrite
+	proxyTransports map[*ProxyTarget]*http.Transport
+	gatewayServices map[string]bool // сервисы, доступные через /gateway
+	authenticator   Authenticator
+	bridgeToken     string        // подтверждает арендатора во внутренних вызовах моста
+	dnsCache        *dnsCache     // nil - кэш выключен
+	proxyCache      *proxyCache   // nil - кэш выключен
+	proxySlots      chan struct{} // семафор ProxyMaxConcurrent, nil - без лимита
+	proxyInFlight   atomic.Int64
+	openConns       atomic.Int64
+	startedAt       time.Time // момент перехода в Running, для uptime
+
+	// Транспорты target'ов с TLS собираются из транспорта клиента
+	// (proxyTransportBases) при первом запросе; под proxyTransportsMu
+	proxyTLS            map[*ProxyTarget]*tls.Config
+	proxyTransportBases map[*ProxyTarget]*http.Transport
+	proxyTransportsMu   sync.Mutex
+
+	grpcClient pb.UltraServiceClient
+	grpcConn   *grpc.ClientConn
+
+	mu          sync.RWMutex
+	reconnectMu sync.Mutex // сериализует ReconnectGRPC
+	initMu      sync.Mutex // держит Initialize; остановка ждет его завершения
+	serverReady bool       // внутренний gRPC клиент подключен
+	muxStarted  bool
+	muxDone     chan struct{} // закрывается, когда cmux Serve вернул управление
+	muxErr      error
+	lifecycle   LifecycleState
+	// serversReady нужен только для State
+	serversReady bool
+	draining     bool
+
+	done     chan struct{}
+	stopOnce sync.Once
+	serveWG  sync.WaitGroup // горутины HTTP, gRPC и cmux Serve
+}
+
+type HTTPHandler struct {
+	multiplexer *UltraMultiplexer
+	routes      map[string]Route
+	paths       []string // порядок регистрации маршрутов
+}
+
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if route, ok := h.routes[r.URL.Path]; ok {
+		if !h.multiplexer.flags.enabled(route.Path) {
+			h.multiplexer.writeError(w, r, http.StatusServiceUnavailable, "endpoint disabled")
+			return
+		}
+		h.applyWriteTimeout(w, route)
+		route.Handler(w, r)
+		return
+	}
+	h.defaultHandler(w, r)
+}
+
+func (h *HTTPHandler) healthCheck(w http.ResponseWriter, r *http.Request) {
+	cfg := h.multiplexer.config.Health
+
+	body := map[string]interface{}{
+		"status":    "ok",
+		"service":   "ultra-multiplexer",
+		"timestamp": h.multiplexer.clock.Now().Format(time.RFC3339),
+	}
+	for key, value := range cfg.Fields {
+		body[key] = value
+	}
+
+	code := http.StatusOK
+	if h.multiplexer.isDraining() {
+		body["status"] = "draining"
+		if cfg.DrainingStatusCode != 0 {
+			code = cfg.DrainingStatusCode
+		}
+	}
+	h.multiplexer.writeJSON(w, code, body)
+}
+
+func (h *HTTPHandler) faviconHandler(w http.ResponseWriter, r *http.Request) {
+	icon := h.multiplexer.config.Favicon
+	if len(icon) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	contentType := http.DetectContentType(icon)
+	if strings.HasPrefix(contentType, "text/") {
+		// SVG DetectContentType распознает как текст
+		contentType = "image/svg+xml"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("Content-Length", strconv.Itoa(len(icon)))
+	if r.Method != http.MethodHead {
+		w.Write(icon)
+	}
+}
+
+func (h *HTTPHandler) defaultHandler(w http.ResponseWriter, r *http.Request) {
+	h.multiplexer.writeJSON(w, 0, map[string]interface{}{
+		"message":       "Ultra Multiplexer HTTP Server",
+		"method":        r.Method,
+		"path":          r.URL.Path,
+		"routes":        h.routeIndex(),
+		"grpc_services": h.multiplexer.grpcIndex(),
+	})
+}
+
+type GRPCServer struct {
+	pb.UnimplementedUltraServiceServer
+	multiplexer *UltraMultiplexer
+}
+
+func (s *GRPCServer) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	message := fmt.Sprintf("Hello %s from Ultra Multiplexer!", req.Name)
+	return &pb.HelloReply{Message: message}, nil
+}
+
+func (s *GRPCServer) ProcessData(ctx context.Context, req *pb.DataRequest) (*pb.DataReply, error) {
+	if err := validateDataRequest(req); err != nil {
+		return nil, err
+	}
+	processed := strings.ToUpper(req.Data)
+	return &pb.DataReply{Processed: processed}, nil
+}
+
+func (s *GRPCServer) ProcessDataStream(req *pb.DataRequest, stream grpc.ServerStreamingServer[pb.DataReply]) error {
+	if err := validateDataRequest(req); err != nil {
+		return err
+	}
+	for _, line := range strings.Split(req.Data, "\n") {
+		if err := stream.Context().Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		if err := stream.Send(&pb.DataReply{Processed: strings.ToUpper(line)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewUltraMultiplexer создает мультиплексор на порту 8080 с DefaultConfig,
+// измененным опциями
+func NewUltraMultiplexer(opts ...Option) *UltraMultiplexer {
+	o := options{port: "8080", config: DefaultConfig()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return NewUltraMultiplexerWithConfig(o.port, o.config)
+}
+
+// defaultResponseHeaderTimeout ограничивает ожидание заголовков upstream'а
+// в транспортах /proxy, если его не задал транспорт клиента
+const defaultResponseHeaderTimeout = 10 * time.Second
+
+func NewUltraMultiplexerWithConfig(port string, config Config) *UltraMultiplexer {
+	clock := config.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	dnsCache := newDNSCache(config.ProxyDNSCache, clock)
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		// Без Client.Timeout: он ограничивает и чтение тела, и большие
+		// загрузки через /proxy обрывались бы. Ожидание заголовков
+		// ограничивает транспорт, тело - контекст запроса и ProxyWriteTimeout
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.ResponseHeaderTimeout = defaultResponseHeaderTimeout
+		if dnsCache != nil {
+			transport.DialContext = dnsCache.dialContext
+		}
+		httpClient = &http.Client{Transport: transport}
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	um := &UltraMultiplexer{
+		port:           port,
+		config:         config,
+		clock:          clock,
+		logger:         logger,
+		httpClient:     httpClient,
+		dnsCache:       dnsCache,
+		proxyCache:     newProxyCache(config.ProxyCache, clock),
+		clientLimiter:  newClientLimiter(config.MaxInFlightPerClient),
+		methodLimiter:  newMethodRateLimiter(config.GRPCRateLimits, clock),
+		handlerPool:    newHandlerPool(config.GRPCWorkerPool),
+		dependencies:   newDependencyChecker(config.UpstreamDependencies, config.UpstreamHealthCacheTTL, clock),
+		retryBudget:    newRetryBudget(config.RetryBudget),
+		bodyLogLimiter: newTokenBucket(bodyLogRate(config.ProxyBodyLog), 1, clock),
+		metrics:        newMetrics(),
+		requestLog:     newRequestRing(config.RequestLogSize),
+		inflight:       newInflightRegistry(),
+		kv:             newKVStore(config.KV, clock),
+		flags:          newFeatureFlags(config.DisabledEndpoints),
+		bridgeToken:    newBridgeToken(),
+		serverReady:    false,
+		muxStarted:     false,
+		done:           make(chan struct{}),
+	}
+	if config.ProxyMaxConcurrent > 0 {
+		um.proxySlots = make(chan struct{}, config.ProxyMaxConcurrent)
+	}
+	um.metrics.Gauge("retry_budget_tokens", um.retryBudget.available)
+	um.metrics.Gauge("kv_keys", func() float64 { return float64(um.kv.len()) })
+	um.metrics.Gauge("connections_open", func() float64 { return float64(um.openConns.Load()) })
+	um.metrics.Gauge("proxy_in_flight", func() float64 { return float64(um.proxyInFlight.Load()) })
+	if um.handlerPool != nil {
+		um.metrics.Gauge("grpc_pool_queued", func() float64 { return float64(um.handlerPool.queued.Load()) })
+		um.metrics.Gauge("grpc_pool_busy", func() float64 { return float64(len(um.handlerPool.slots)) })
+	}
+
+	return um
+}
+
+// Initialize создает listener, cmux и серверы. Допустим один раз, до Start.
+func (um *UltraMultiplexer) Initialize() error {
+	// initialize заполняет поля и запускает Serve горутины без um.mu:
+	// beginStop ждет initMu, чтобы Stop не проскочил посередине
+	um.initMu.Lock()
+	defer um.initMu.Unlock()
+
+	if err := um.transition(LifecycleNew, LifecycleInitializing); err != nil {
+		return err
+	}
+	if err := um.initialize(); err != nil {
+		um.transition(LifecycleInitializing, LifecycleNew)
+		return err
+	}
+	return um.transition(LifecycleInitializing, LifecycleInitialized)
+}
+
+func (um *UltraMultiplexer) initialize() error {
+	if err := um.validateProxyTargets(); err != nil {
+		return err
+	}
+	if err := um.parseErrorPage(); err != nil {
+		return err
+	}
+	if err := um.validateAccessRules(); err != nil {
+		return err
+	}
+	if err := um.validateGatewayServices(); err != nil {
+		return err
+	}
+
+	listener := um.config.Listener
+	if listener == nil && um.config.ListenFD > 0 {
+		var err error
+		if listener, err = fileListener(um.config.ListenFD); err != nil {
+			return err
+		}
+	}
+	if listener == nil {
+		var err error
+		if listener, err = um.listen(); err != nil {
+			return err
+		}
+	} else if _, port, err := net.SplitHostPort(listener.Addr().String()); err == nil {
+		um.port = port
+	}
+	if um.config.DisableTCPNoDelay || um.config.TCPReadBuffer > 0 || um.config.TCPWriteBuffer > 0 {
+		// Самая внутренняя обертка: опциям нужен *net.TCPConn
+		listener = &tcpTuningListener{
+			Listener:    listener,
+			noDelay:     !um.config.DisableTCPNoDelay,
+			readBuffer:  um.config.TCPReadBuffer,
+			writeBuffer: um.config.TCPWriteBuffer,
+			logger:      um.logger,
+		}
+	}
+	if um.config.ConnIdleTimeout > 0 {
+		listener = &idleTimeoutListener{
+			Listener: listener,
+			timeout:  um.config.ConnIdleTimeout,
+			metrics:  um.metrics,
+			logger:   um.logger,
+		}
+	}
+	var tlsConfig *tls.Config
+	if um.tlsEnabled() {
+		var err error
+		if tlsConfig, err = um.buildTLSConfig(); err != nil {
+			listener.Close()
+			return err
+		}
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	// Самая внешняя обертка: момент accept для метрики матчинга cmux
+	listener = &acceptTimingListener{Listener: listener, clock: um.clock, metrics: um.metrics, open: &um.openConns}
+	um.acceptErrs = &acceptErrorListener{Listener: listener, failed: make(chan struct{})}
+	listener = um.acceptErrs
+	um.listener = listener
+	um.readinessClient = &http.Client{
+		Timeout:   1 * time.Second,
+		Transport: um.selfHTTPTransport(),
+	}
+
+	um.mux = cmux.New(listener)
+	um.mux.HandleError(um.handleMuxError)
+
+	// Пользовательские протоколы проверяются первыми: HTTP/2 матчеры ждут
+	// 24 байта preface и заблокировали бы клиента, который шлет меньше
+	// и ждет ответа (например, PostgreSQL)
+	customListeners := make([]net.Listener, len(um.customMatchers))
+	for i, custom := range um.customMatchers {
+		customListeners[i] = &protocolListener{
+			Listener: um.mux.Match(custom.matcher),
+			protocol: "custom_" + strconv.Itoa(i),
+			um:       um,
+		}
+	}
+
+	// ВАЖНО: Используем более надежные матчеры
+	grpcListener := um.mux.MatchWithWriters(
+		cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"),
+	)
+	// HTTP/2 с prior knowledge (preface PRI *), но не gRPC
+	h2cListener := um.mux.Match(cmux.HTTP2())
+	// На порту без TLS ClientHello иначе попал бы в Any, и HTTP сервер
+	// отвечал бы мусором на handshake
+	var plaintextTLSListener net.Listener
+	if tlsConfig == nil {
+		plaintextTLSListener = &protocolListener{Listener: um.mux.Match(cmux.TLS()), protocol: "tls", um: um}
+	}
+	httpListener := um.mux.Match(cmux.Any())
+	grpcListener = &protocolListener{Listener: grpcListener, protocol: "grpc", um: um}
+	h2cListener = &protocolListener{Listener: h2cListener, protocol: "h2c", um: um}
+	httpListener = &protocolListener{Listener: httpListener, protocol: "http", um: um}
+
+	um.httpHandler = newHTTPHandler(um, um.httpRoutes)
+	var handler http.Handler = um.httpHandler
+	if um.chaosEnabled() {
+		um.logger.Printf("🐛 Chaos mode enabled: %d rule(s)", len(um.config.Chaos.Rules))
+		handler = um.chaosMiddleware(handler)
+	}
+	handler = um.clientLimitMiddleware(handler)
+	if len(um.config.AccessRules) > 0 {
+		handler = um.accessControlMiddleware(handler)
+	}
+	if um.authenticator != nil || um.tenantAuthEnabled() {
+		handler = um.authMiddleware(handler)
+	}
+	handler = um.accessLogMiddleware(handler)
+
+	var http3Conn net.PacketConn
+	tcpHandler := handler
+	if um.config.HTTP3 != nil {
+		var err error
+		if http3Conn, err = um.setupHTTP3(handler, tlsConfig); err != nil {
+			listener.Close()
+			return err
+		}
+		tcpHandler = um.altSvcMiddleware(handler)
+	}
+	// net/http не видит *tls.Conn за cmux и сам HTTP/2 не включит: h2 по
+	// ALPN и h2c с prior knowledge обслуживаем через h2c обработчик
+	um.httpServer = &http.Server{
+		Handler:      h2c.NewHandler(tcpHandler, &http2.Server{}),
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		ErrorLog:     um.logger,
+	}
+	if um.tlsEnabled() {
+		um.httpServer.ConnContext = um.tenantConnContext
+	}
+
+	grpcOpts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(um.unaryChain()...),
+		grpc.ChainStreamInterceptor(um.streamChain()...),
+	}
+	if um.tlsEnabled() && len(um.config.TLS.Tenants) > 0 {
+		// TLS уже снят до cmux; креды только переносят SNI арендатора в peer
+		grpcOpts = append(grpcOpts, grpc.Creds(tenantCredentials{um: um}))
+	}
+	if workers := um.grpcStreamWorkers(); workers > 0 {
+		grpcOpts = append(grpcOpts, grpc.NumStreamWorkers(uint32(workers)))
+	}
+	if um.config.ConnIdleTimeout > 0 || um.config.GRPCMaxConnectionAge > 0 {
+		// Нулевые поля grpc заменяет своими значениями по умолчанию (без лимита)
+		grpcOpts = append(grpcOpts, grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle:     um.config.ConnIdleTimeout,
+			MaxConnectionAge:      um.config.GRPCMaxConnectionAge,
+			MaxConnectionAgeGrace: um.config.GRPCMaxConnectionAgeGrace,
+		}))
+	}
+	um.grpcServer = grpc.NewServer(grpcOpts...)
+	grpcServerImpl := &GRPCServer{multiplexer: um}
+	pb.RegisterUltraServiceServer(um.grpcServer, grpcServerImpl)
+
+	// Стандартный health сервис; Watch получает обновления от SetServingStatus
+	um.healthSrv = health.NewServer()
+	um.healthSrv.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	um.healthSrv.SetServingStatus(pb.UltraService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(um.grpcServer, um.healthSrv)
+
+	if um.config.DebugEnabled {
+		pb.RegisterDebugServiceServer(um.grpcServer, &DebugServer{})
+	}
+
+	for _, register := range um.grpcRegistrations {
+		register(um.grpcServer)
+	}
+	um.buildGatewayServices()
+
+	// Запускаем серверы
+	um.serveWG.Add(3)
+	go func() {
+		defer um.serveWG.Done()
+		um.logger.Println("🌐 Starting HTTP server...")
+		if err := um.httpServer.Serve(httpListener); err != nil {
+			um.logger.Printf("HTTP server error: %v", err)
+		}
+	}()
+
+	// Тот же http.Server на втором listener: Shutdown закроет оба
+	go func() {
+		defer um.serveWG.Done()
+		if err := um.httpServer.Serve(h2cListener); err != nil {
+			um.logger.Printf("h2c server error: %v", err)
+		}
+	}()
+
+	go func() {
+		defer um.serveWG.Done()
+		um.logger.Println("🔗 Starting gRPC server...")
+		if err := um.grpcServer.Serve(grpcListener); err != nil {
+			um.logger.Printf("gRPC server error: %v", err)
+		}
+	}()
+
+	for i, custom := range um.customMatchers {
+		um.serveWG.Add(1)
+		go func(serve func(net.Listener), listener net.Listener) {
+			defer um.serveWG.Done()
+			serve(listener)
+		}(custom.handler, customListeners[i])
+	}
+
+	if plaintextTLSListener != nil {
+		um.serveWG.Add(1)
+		go func() {
+			defer um.serveWG.Done()
+			um.rejectTLSConns(plaintextTLSListener)
+		}()
+	}
+
+	if http3Conn != nil {
+		um.serveWG.Add(1)
+		go func() {
+			defer um.serveWG.Done()
+			um.logger.Printf("⚡ Starting HTTP/3 server on udp %s...", http3Conn.LocalAddr())
+			if err := um.http3Server.Serve(http3Conn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				um.logger.Printf("HTTP/3 server error: %v", err)
+			}
+			http3Conn.Close()
+		}()
+	}
+
+	return nil
+}
+
+func (um *UltraMultiplexer) startMux() {
+	um.mu.Lock()
+	if um.muxStarted {
+		um.mu.Unlock()
+		return
+	}
+	um.muxStarted = true
+	muxDone := make(chan struct{})
+	um.muxDone = muxDone
+	um.mu.Unlock()
+
+	um.serveWG.Add(1)
+	go func() {
+		defer um.serveWG.Done()
+		defer close(muxDone)
+		um.logger.Println("🚀 Starting cmux...")
+		err := um.mux.Serve()
+		if err != nil {
+			um.logger.Printf("Mux serve error: %v", err)
+		}
+		um.mu.Lock()
+		um.muxErr = err
+		um.mu.Unlock()
+	}()
+}
+
+// checkMuxServing проверяет, что цикл cmux Serve запущен и не завершился.
+// Отличает "mux умер" от "сервер медленно стартует" без сетевых вызовов
+func (um *UltraMultiplexer) checkMuxServing() error {
+	um.mu.RLock()
+	muxDone, muxErr := um.muxDone, um.muxErr
+	um.mu.RUnlock()
+
+	if muxDone == nil {
+		return fmt.Errorf("%w: not started", ErrMuxNotServing)
+	}
+	select {
+	case <-muxDone:
+		if muxErr != nil {
+			return fmt.Errorf("%w: %w", ErrMuxNotServing, muxErr)
+		}
+		return ErrMuxNotServing
+	case <-um.acceptErrs.failed:
+		return fmt.Errorf("%w: %w", ErrMuxNotServing, um.acceptErrs.err)
+	default:
+		return nil
+	}
+}
+
+// waitForServerReady опрашивает HTTP и gRPC через self-dial раз в
+// ReadinessPollInterval, пока не истечет StartupTimeout. Отмена ctx
+// прерывает ожидание с ошибкой контекста
+func (um *UltraMultiplexer) waitForServerReady(ctx context.Context) error {
+	um.logger.Println("⏳ Waiting for servers to be ready...")
+
+	interval := um.config.ReadinessPollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	timeout := um.config.StartupTimeout
+	if timeout <= 0 {
+		timeout = 20 * time.Second
+	}
+	started := um.clock.Now()
+	deadline := started.Add(timeout)
+
+	pending := "HTTP"
+	for attempts := 1; ; attempts++ {
+		if um.stopping() {
+			return ErrStopped
+		}
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%w: startup canceled after %d attempts (%s server not ready): %w", ErrServersNotReady, attempts-1, pending, err)
+		}
+
+		// Без работающего cmux self-dial'ы не пройдут никогда, ждать бессмысленно
+		if err := um.checkMuxServing(); err != nil {
+			return err
+		}
+
+		// Сначала HTTP, затем gRPC
+		pending = "HTTP"
+		if um.checkHTTPReady(ctx) {
+			pending = "gRPC"
+			if um.checkGRPCReady(ctx) {
+				um.logger.Printf("✅ Both servers are ready! (%v, %d attempts)", um.clock.Now().Sub(started).Round(time.Millisecond), attempts)
+				um.mu.Lock()
+				um.serversReady = true
+				um.mu.Unlock()
+				return nil
+			}
+		}
+
+		remaining := deadline.Sub(um.clock.Now())
+		if remaining <= 0 {
+			return fmt.Errorf("%w: startup timeout %v exceeded after %d attempts (%s server not ready)", ErrServersNotReady, timeout, attempts, pending)
+		}
+		um.logger.Printf("🔄 %s server not ready yet... (attempt %d, %v left)", pending, attempts, remaining.Round(time.Second))
+		// Без RetryJitter: опрос своих же серверов не создает нагрузки на
+		// upstream, а случайные паузы меняли бы время старта
+		um.sleepContext(ctx, min(interval, remaining))
+	}
+}
+
+// sleepContext - clock.Sleep, который прерывается отменой ctx
+func (um *UltraMultiplexer) sleepContext(ctx context.Context, d time.Duration) {
+	select {
+	case <-um.clock.After(d):
+	case <-ctx.Done():
+	}
+}
+
+func (um *UltraMultiplexer) checkHTTPReady(ctx context.Context) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, um.selfURL("/health"), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := um.readinessClient.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	// Тело не нужно, но читаем его с ограничением на случай неисправного /health
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	return resp.StatusCode == http.StatusOK
+}
+
+func (um *UltraMultiplexer) checkGRPCReady(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, "localhost:"+um.port,
+		um.selfDialOptions()...)
+
+	if err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		return false
+	}
+
+	conn.Close()
+	return true
+}
+
+// dialGRPCClient устанавливает внутреннее gRPC соединение к себе
+func (um *UltraMultiplexer) dialGRPCClient(ctx context.Context) (*grpc.ClientConn, error) {
+	// Используем более длительный таймаут для подключения
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, "localhost:"+um.port,
+		um.selfDialOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrGRPCClientInit, err)
+	}
+	return conn, nil
+}
+
+func (um *UltraMultiplexer) initGRPCClient(ctx context.Context) error {
+	um.logger.Println("🔌 Initializing gRPC client...")
+
+	conn, err := um.dialGRPCClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	um.mu.Lock()
+	if um.lifecycle >= LifecycleStopping {
+		// Остановка уже закрыла старое соединение, новое никто не закроет
+		um.mu.Unlock()
+		conn.Close()
+		return ErrStopped
+	}
+	if um.grpcConn != nil {
+		// Клиент уже подключен параллельно (ReconnectGRPC)
+		um.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	um.grpcConn = conn
+	um.grpcClient = pb.NewUltraServiceClient(conn)
+	um.serverReady = true
+	um.mu.Unlock()
+
+	um.logger.Println("✅ gRPC client successfully connected!")
+	return nil
+}
+
+// connectGRPCClient подключает внутренний gRPC клиент с повторами, пока
+// не получится или мультиплексор не остановят. Контекст старта сюда не
+// передается: его дедлайн истек бы уже после старта и навсегда оставил
+// /grpc-call без клиента
+func (um *UltraMultiplexer) connectGRPCClient() {
+	defer um.serveWG.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-um.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for attempt := 0; ; attempt++ {
+		err := um.initGRPCClient(ctx)
+		if err == nil || errors.Is(err, ErrStopped) || ctx.Err() != nil {
+			return
+		}
+
+		delay := um.withJitter(retryBackoff(attempt))
+		um.logger.Printf("⚠️ gRPC client not connected (attempt %d), retrying in %v: %v", attempt+1, delay, err)
+		select {
+		case <-um.clock.After(delay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (um *UltraMultiplexer) isDraining() bool {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+	return um.draining
+}
+
+func (um *UltraMultiplexer) isGRPCClientReady() bool {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+	return um.serverReady
+}
+
+func (um *UltraMultiplexer) currentGRPCConn() *grpc.ClientConn {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+	return um.grpcConn
+}
+
+func (um *UltraMultiplexer) currentGRPCClient() pb.UltraServiceClient {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+	return um.grpcClient
+}
+
+// Start запускает серверы и блокируется до остановки. Если cmux завершился
+// сам (ошибка accept на корневом listener), мультиплексор останавливается,
+// а Start возвращает ошибку с ErrMuxNotServing.
+func (um *UltraMultiplexer) Start() error {
+	return um.StartContext(context.Background())
+}
+
+// StartContext - Start с контекстом старта. Отмена ctx до перехода в
+// LifecycleRunning прерывает ожидание готовности: серверы останавливаются,
+// возвращается ошибка с ctx.Err(). После старта ctx ни на что не влияет;
+// останавливать мультиплексор нужно через Stop или Shutdown.
+func (um *UltraMultiplexer) StartContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := um.transition(LifecycleInitialized, LifecycleStarting); err != nil {
+		return err
+	}
+	um.logger.Printf("🚀 Ultra Multiplexer starting on port %s", um.port)
+
+	// 1. Запускаем cmux
+	um.startMux()
+
+	// 2. Ждем готовности серверов
+	if err := um.waitForServerReady(ctx); err != nil {
+		return um.abortStart(err)
+	}
+
+	if err := um.transition(LifecycleStarting, LifecycleRunning); err != nil {
+		// Stop пришел, пока мы стартовали
+		<-um.done
+		return nil
+	}
+
+	// 3. gRPC клиент моста подключаем в фоне: HTTP (/health, /proxy) от него
+	// не зависит, /grpc-call отвечает 503, пока клиент не подключится
+	um.serveWG.Add(1)
+	go um.connectGRPCClient()
+
+	um.mu.Lock()
+	um.startedAt = um.clock.Now()
+	um.mu.Unlock()
+	if um.config.HeartbeatInterval > 0 {
+		um.serveWG.Add(1)
+		go um.runHeartbeat()
+	}
+	um.serveWG.Add(1)
+	go um.runKVSweeper()
+
+	um.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	um.SetServingStatus(pb.UltraService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+
+	um.logger.Printf("📡 HTTP endpoints: %s", strings.Join(um.httpHandler.paths, ", "))
+	um.logger.Printf("🔗 gRPC services: %s", strings.Join(um.grpcServiceNames(), ", "))
+	um.logger.Printf("✅ Ultra Multiplexer is fully ready!")
+
+	// Блокируем основной поток до остановки или падения cmux
+	um.mu.RLock()
+	muxDone := um.muxDone
+	um.mu.RUnlock()
+	select {
+	case <-um.done:
+		return nil
+	case <-muxDone:
+	case <-um.acceptErrs.failed:
+	}
+	if um.stopping() {
+		// cmux завершился из-за Stop/Shutdown
+		<-um.done
+		return nil
+	}
+
+	// Без cmux порт больше не принимает соединения, хотя процесс жив:
+	// останавливаемся и отдаем ошибку вызывающему
+	err := um.checkMuxServing()
+	um.logger.Printf("💥 cmux stopped unexpectedly, shutting down: %v", err)
+	um.metrics.Inc("cmux_fatal_errors_total")
+	um.Stop()
+	if waitErr := um.waitServeGoroutines(context.Background()); waitErr != nil {
+		return errors.Join(err, waitErr)
+	}
+	return err
+}
+
+// abortStart останавливает уже запущенные серверы, если старт не удался,
+// чтобы не оставлять висящих горутин и открытых листенеров
+func (um *UltraMultiplexer) abortStart(cause error) error {
+	um.logger.Printf("⚠️ Startup failed, tearing down: %v", cause)
+	um.Stop()
+	if err := um.waitServeGoroutines(context.Background()); err != nil {
+		return errors.Join(cause, err)
+	}
+	return cause
+}
+
+// grpcStreamWorkers подбирает число gRPC воркеров; при AutoTuneCPU - по
+// квоте CPU контейнера
+func (um *UltraMultiplexer) grpcStreamWorkers() int {
+	if !um.config.AutoTuneCPU {
+		return um.config.GRPCStreamWorkers
+	}
+
+	// GOMAXPROCS - настройка всего процесса, ее выбирает встраивающее
+	// приложение; мы только подсказываем
+	cpus := effectiveCPUs()
+	if procs := runtime.GOMAXPROCS(0); cpus < procs {
+		um.logger.Printf("⚙️ CPU quota is %d, but GOMAXPROCS is %d; consider setting GOMAXPROCS=%d", cpus, procs, cpus)
+	}
+
+	if um.config.GRPCStreamWorkers > 0 {
+		return um.config.GRPCStreamWorkers
+	}
+	return cpus
+}
+
+type customMatcher struct {
+	matcher cmux.Matcher
+	handler func(net.Listener)
+}
+
+// RegisterMatcher направляет соединения, подошедшие под matcher, в
+// отдельный listener, который обслуживает handler (например, свой бинарный
+// протокол или PostgreSQL wire). Пользовательские матчеры проверяются до
+// gRPC и HTTP в порядке регистрации. handler запускается в отдельной
+// горутине и должен вернуться, когда listener закроется при остановке.
+// Должен вызываться до Initialize.
+func (um *UltraMultiplexer) RegisterMatcher(matcher cmux.Matcher, handler func(net.Listener)) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.customMatchers = append(um.customMatchers, customMatcher{matcher, handler})
+}
+
+// RegisterGRPCService добавляет регистрацию дополнительного gRPC сервиса
+// на общем порту. Должен вызываться до Initialize.
+func (um *UltraMultiplexer) RegisterGRPCService(register func(*grpc.Server)) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.grpcRegistrations = append(um.grpcRegistrations, register)
+}
+
+// UseListener задает готовый listener (systemd socket activation, PROXY
+// protocol, внешний TLS) вместо net.Listen. Должен вызываться до Initialize.
+func (um *UltraMultiplexer) UseListener(listener net.Listener) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.config.Listener = listener
+}
+
+// ServeWithListener инициализирует мультиплексор поверх переданного
+// listener и блокируется до остановки, как Start
+func (um *UltraMultiplexer) ServeWithListener(listener net.Listener) error {
+	um.UseListener(listener)
+	if err := um.Initialize(); err != nil {
+		return err
+	}
+	return um.Start()
+}
+
+func (um *UltraMultiplexer) grpcServiceNames() []string {
+	info := um.grpcServer.GetServiceInfo()
+	names := make([]string, 0, len(info))
+	for name := range info {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Metrics возвращает реестр метрик мультиплексора, в который встраивающий
+// код может добавлять свои счетчики
+func (um *UltraMultiplexer) Metrics() *Metrics {
+	return um.metrics
+}
+
+// SetHTTPClient подменяет клиент, через который /proxy ходит в upstream
+// (например, клиент с заглушкой RoundTripper в тестах)
+func (um *UltraMultiplexer) SetHTTPClient(client *http.Client) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.httpClient = client
+}
+
+func (um *UltraMultiplexer) getHTTPClient() *http.Client {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+	return um.httpClient
+}
+
+// SetServingStatus обновляет статус сервиса в gRPC health и уведомляет Watch подписчиков
+func (um *UltraMultiplexer) SetServingStatus(service string, status healthpb.HealthCheckResponse_ServingStatus) {
+	if um.healthSrv == nil {
+		return
+	}
+	um.healthSrv.SetServingStatus(service, status)
+}
+
+func (um *UltraMultiplexer) Stop() error {
+	if !um.beginStop() {
+		return nil
+	}
+
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	if um.healthSrv != nil {
+		// Переводит все сервисы в NOT_SERVING и оповещает watchers
+		um.healthSrv.Shutdown()
+	}
+
+	if um.grpcConn != nil {
+		um.grpcConn.Close()
+	}
+
+	if um.httpServer != nil {
+		um.httpServer.Close()
+	}
+
+	if um.http3Server != nil {
+		um.http3Server.Close()
+	}
+
+	if um.grpcServer != nil {
+		um.grpcServer.Stop()
+	}
+
+	if um.listener != nil {
+		um.listener.Close()
+	}
+
+	um.serverReady = false
+	um.serversReady = false
+	um.lifecycle = LifecycleStopped
+	um.markStopped()
+	return nil
+}
+
+// Shutdown плавно останавливает мультиплексор: перестает принимать новые
+// соединения, затем дренирует HTTP и gRPC. Каждая подсистема ограничена своим таймаутом; если она не
+// уложилась, ее останавливают принудительно и возвращают *ForceStopError.
+func (um *UltraMultiplexer) Shutdown(ctx context.Context) error {
+	if !um.beginStop() {
+		return nil
+	}
+
+	// Не держим мьютекс во время дренажа: активные обработчики читают состояние
+	um.mu.Lock()
+	httpServer, grpcServer := um.httpServer, um.grpcServer
+	um.draining = true
+	um.mu.Unlock()
+
+	if um.healthSrv != nil {
+		um.healthSrv.Shutdown()
+	}
+
+	// Балансировщик мог еще не убрать нас из эндпоинтов: продолжаем
+	// обслуживать запросы, пока /readyz уже отвечает not ready
+	if delay := um.config.PreShutdownDelay; delay > 0 {
+		um.logger.Printf("⏳ Draining: waiting %v before shutdown", delay)
+		select {
+		case <-um.clock.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	// Новые соединения больше не принимаем: закрытие корневого listener'а
+	// завершает cmux и его под-listener'ы, а уже принятые соединения
+	// продолжают обслуживаться до дренажа ниже
+	if um.listener != nil {
+		um.listener.Close()
+		um.logger.Println("🛑 Stopped accepting new connections, draining in-flight requests")
+	}
+
+	var forced []string
+
+	if um.http3Server != nil {
+		h3Ctx, cancel := withOptionalTimeout(ctx, um.config.ShutdownTimeout)
+		err := um.http3Server.Shutdown(h3Ctx)
+		cancel()
+		if err != nil {
+			um.logger.Printf("⚠️ HTTP/3 drain did not finish: %v, forcing close", err)
+			um.http3Server.Close()
+			forced = append(forced, "http3")
+		}
+	}
+
+	if httpServer != nil {
+		httpCtx, cancel := withOptionalTimeout(ctx, um.config.ShutdownTimeout)
+		err := httpServer.Shutdown(httpCtx)
+		cancel()
+		// Под-listener'ы cmux уже закрыты вместе с корневым: ошибка их
+		// повторного закрытия не означает, что дренаж не удался
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			um.logger.Printf("⚠️ HTTP drain did not finish: %v, forcing close", err)
+			httpServer.Close()
+			forced = append(forced, "http")
+		}
+	}
+
+	// HTTP мост больше не нужен, закрываем внутренний клиент до дренажа gRPC
+	um.mu.Lock()
+	if um.grpcConn != nil {
+		um.grpcConn.Close()
+	}
+	um.serverReady = false
+	um.serversReady = false
+	um.mu.Unlock()
+
+	if grpcServer != nil && !um.gracefulStopGRPC(ctx, grpcServer) {
+		forced = append(forced, "grpc")
+	}
+
+	// Серверы остановлены - можно освобождать ресурсы встраивающего кода
+	hookErr := um.runShutdownHooks(ctx)
+
+	um.mu.Lock()
+	um.lifecycle = LifecycleStopped
+	um.mu.Unlock()
+	um.markStopped()
+
+	var err error
+	if len(forced) > 0 {
+		err = &ForceStopError{Subsystems: forced}
+	} else {
+		err = um.waitServeGoroutines(ctx)
+	}
+	if hookErr != nil {
+		return errors.Join(err, hookErr)
+	}
+	return err
+}
+
+// waitServeGoroutines ждет завершения всех Serve горутин, но не дольше ShutdownTimeout
+func (um *UltraMultiplexer) waitServeGoroutines(ctx context.Context) error {
+	waitCtx, cancel := withOptionalTimeout(ctx, um.config.ShutdownTimeout)
+	defer cancel()
+
+	exited := make(chan struct{})
+	go func() {
+		um.serveWG.Wait()
+		close(exited)
+	}()
+
+	select {
+	case <-exited:
+		return nil
+	case <-waitCtx.Done():
+		return fmt.Errorf("%w: %w", ErrServeNotExited, waitCtx.Err())
+	}
+}
+
+// gracefulStopGRPC возвращает false, если пришлось вызвать Stop
+func (um *UltraMultiplexer) gracefulStopGRPC(ctx context.Context, server *grpc.Server) bool {
+	drainCtx, cancel := withOptionalTimeout(ctx, um.config.GRPCDrainTimeout)
+	defer cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return true
+	case <-drainCtx.Done():
+		um.logger.Printf("⚠️ gRPC drain did not finish: %v, forcing stop", drainCtx.Err())
+		server.Stop()
+		<-stopped
+		return false
+	}
+}
+
+func (um *UltraMultiplexer) markStopped() {
+	um.stopOnce.Do(func() {
+		close(um.done)
+	})
+}
+
+func withOptionalTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,707 @@
+package ultramux
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/soheilhy/cmux"
+	"go.uber.org/goleak"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// newTestMultiplexer создает мультиплексор на свободном порту 127.0.0.1
+func newTestMultiplexer(t *testing.T, config Config) *UltraMultiplexer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	config.Listener = listener
+	config.StartupTimeout = 5 * time.Second
+	config.ReadinessPollInterval = 50 * time.Millisecond
+	return NewUltraMultiplexerWithConfig("0", config)
+}
+
+// startTestMultiplexer инициализирует и запускает um в фоне, дожидаясь
+// LifecycleRunning. В канал придет результат Start
+func startTestMultiplexer(t *testing.T, um *UltraMultiplexer) <-chan error {
+	t.Helper()
+	if err := um.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	startErr := make(chan error, 1)
+	go func() { startErr <- um.Start() }()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for um.Lifecycle() != LifecycleRunning {
+		select {
+		case err := <-startErr:
+			t.Fatalf("Start returned before running: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			um.Stop()
+			t.Fatalf("multiplexer not running, lifecycle %s", um.Lifecycle())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Cleanup(func() { um.Stop() })
+	return startErr
+}
+
+// waitStartReturned ждет возврата Start после остановки
+func waitStartReturned(t *testing.T, startErr <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-startErr:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("Start did not return after stop")
+		return nil
+	}
+}
+
+type rejectAllAuthenticator struct{}
+
+func (rejectAllAuthenticator) Authenticate(context.Context, Credentials) (Identity, error) {
+	return Identity{}, errors.New("denied")
+}
+
+func TestStartFailureTearsDown(t *testing.T) {
+	// Горутины других тестов (keep-alive соединения и т.п.) не считаем
+	before := goleak.IgnoreCurrent()
+
+	// /health требует аутентификации и всегда отвечает 401: готовность
+	// не наступит никогда
+	config := DefaultConfig()
+	config.AuthSkipPaths = nil
+	um := newTestMultiplexer(t, config)
+	um.config.StartupTimeout = 300 * time.Millisecond
+	um.SetAuthenticator(rejectAllAuthenticator{})
+	addr := um.config.Listener.Addr().String()
+
+	if err := um.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	err := um.Start()
+	if !errors.Is(err, ErrServersNotReady) {
+		t.Fatalf("Start error = %v, want ErrServersNotReady", err)
+	}
+	if got := um.Lifecycle(); got != LifecycleStopped {
+		t.Fatalf("lifecycle = %s, want stopped", got)
+	}
+
+	// Порт освобожден
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("port %s not released: %v", addr, err)
+	}
+	listener.Close()
+
+	goleak.VerifyNone(t, before)
+}
+
+func TestShutdownLeavesNoGoroutines(t *testing.T) {
+	// Горутины других тестов (keep-alive соединения и т.п.) не считаем
+	before := goleak.IgnoreCurrent()
+
+	um := newTestMultiplexer(t, DefaultConfig())
+	startErr := startTestMultiplexer(t, um)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := um.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := waitStartReturned(t, startErr); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	goleak.VerifyNone(t, before)
+}
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	um := newTestMultiplexer(t, DefaultConfig())
+	um.RegisterRoute(Route{
+		Path:    "/slow",
+		Methods: []string{http.MethodGet},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			close(entered)
+			<-release
+			io.WriteString(w, "done")
+		},
+	})
+	addr := um.config.Listener.Addr().String()
+	startErr := startTestMultiplexer(t, um)
+
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		slow <- result{body: string(body), err: err}
+	}()
+	<-entered
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- um.Shutdown(context.Background()) }()
+
+	// Новые соединения отклоняются, пока медленный запрос еще выполняется
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("new connections still accepted during shutdown")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown returned before in-flight request finished: %v", err)
+	default:
+	}
+
+	close(release)
+	got := <-slow
+	if got.err != nil || got.body != "done" {
+		t.Fatalf("in-flight request = %q, %v; want \"done\"", got.body, got.err)
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := waitStartReturned(t, startErr); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+}
+
+// recordingClock - системные часы, запоминающие задержки After
+type recordingClock struct {
+	realClock
+	mu     sync.Mutex
+	delays []time.Duration
+}
+
+func (c *recordingClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	c.delays = append(c.delays, d)
+	c.mu.Unlock()
+	return c.realClock.After(d)
+}
+
+func TestReadinessPollIgnoresRetryJitter(t *testing.T) {
+	config := DefaultConfig()
+	config.AuthSkipPaths = nil
+	config.RetryJitter = JitterFull
+	um := newTestMultiplexer(t, config)
+	um.config.StartupTimeout = 300 * time.Millisecond
+	clock := &recordingClock{}
+	um.clock = clock
+	um.SetAuthenticator(rejectAllAuthenticator{})
+
+	if err := um.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if err := um.Start(); !errors.Is(err, ErrServersNotReady) {
+		t.Fatalf("Start error = %v, want ErrServersNotReady", err)
+	}
+
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	polls := 0
+	for _, d := range clock.delays {
+		if d == um.config.ReadinessPollInterval {
+			polls++
+		}
+	}
+	if polls < 3 {
+		t.Fatalf("readiness poll delays %v, want a fixed %v between attempts", clock.delays, um.config.ReadinessPollInterval)
+	}
+}
+
+func TestInitializeErrorsWrapSentinels(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer busy.Close()
+	_, port, _ := net.SplitHostPort(busy.Addr().String())
+
+	um := NewUltraMultiplexerWithConfig(port, DefaultConfig())
+	err = um.Initialize()
+	if !errors.Is(err, ErrListen) || !errors.Is(err, ErrPortInUse) {
+		t.Fatalf("Initialize on a busy port = %v, want ErrListen and ErrPortInUse", err)
+	}
+	if got := um.Lifecycle(); got != LifecycleNew {
+		t.Fatalf("lifecycle after failed Initialize = %s, want new", got)
+	}
+
+	config := DefaultConfig()
+	config.AccessRules = []AccessRule{{Path: "/api/["}}
+	um = newTestMultiplexer(t, config)
+	defer um.config.Listener.Close()
+	if err := um.Initialize(); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Initialize with a bad access rule = %v, want ErrInvalidConfig", err)
+	}
+}
+
+func TestStartContextCancelStopsReadinessWait(t *testing.T) {
+	// Готовность не наступит: /health всегда отвечает 401
+	config := DefaultConfig()
+	config.AuthSkipPaths = nil
+	um := newTestMultiplexer(t, config)
+	um.SetAuthenticator(rejectAllAuthenticator{})
+	if err := um.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	err := um.StartContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("StartContext = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > um.config.StartupTimeout/2 {
+		t.Fatalf("StartContext returned after %v, cancellation ignored", elapsed)
+	}
+	if got := um.Lifecycle(); got != LifecycleStopped {
+		t.Fatalf("lifecycle = %s, want stopped", got)
+	}
+}
+
+func TestShutdownForcesStuckGRPCAfterDrainTimeout(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	config := DefaultConfig()
+	config.GRPCDrainTimeout = 100 * time.Millisecond
+	um := newTestMultiplexer(t, config)
+	um.RegisterGRPCService(registerPingService)
+	um.UseUnaryInterceptor(StageHandler, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		close(entered)
+		// Stop отменяет контекст вызова - без этого GracefulStop ждал бы вечно
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return handler(ctx, req)
+	})
+	addr := um.config.Listener.Addr().String()
+	startErr := startTestMultiplexer(t, um)
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	go conn.Invoke(context.Background(), "/ultramux.test.Ping/Ping", &emptypb.Empty{}, &emptypb.Empty{})
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	err = um.Shutdown(ctx)
+	var forced *ForceStopError
+	if !errors.As(err, &forced) || len(forced.Subsystems) != 1 || forced.Subsystems[0] != "grpc" {
+		t.Fatalf("Shutdown = %v, want ForceStopError for grpc", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Shutdown took %v despite GRPCDrainTimeout", elapsed)
+	}
+	waitStartReturned(t, startErr)
+}
+
+func TestH2CPriorKnowledge(t *testing.T) {
+	um := newTestMultiplexer(t, DefaultConfig())
+	addr := um.config.Listener.Addr().String()
+	startTestMultiplexer(t, um)
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	// Проверки готовности тоже открывают соединения - считаем разницу
+	before, _ := um.metrics.Snapshot()["counters"].(map[string]int64)
+	resp, err := client.Get("http://" + addr + "/health")
+	if err != nil {
+		t.Fatalf("h2c GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+		t.Fatalf("got %d over %s, want 200 over HTTP/2", resp.StatusCode, resp.Proto)
+	}
+	counters, _ := um.metrics.Snapshot()["counters"].(map[string]int64)
+	if counters["cmux_connections_h2c_total"]-before["cmux_connections_h2c_total"] != 1 ||
+		counters["cmux_connections_http_total"] != before["cmux_connections_http_total"] {
+		t.Fatalf("h2c connection matched as %v", counters)
+	}
+}
+
+func TestRegisterMatcherRoutesCustomProtocol(t *testing.T) {
+	um := newTestMultiplexer(t, DefaultConfig())
+	um.RegisterMatcher(cmux.PrefixMatcher("PING"), func(l net.Listener) {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				io.WriteString(conn, "PONG "+line)
+			}()
+		}
+	})
+	addr := um.config.Listener.Addr().String()
+	startTestMultiplexer(t, um)
+
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "PING custom\n")
+	if reply, _ := bufio.NewReader(conn).ReadString('\n'); reply != "PONG PING custom\n" {
+		t.Fatalf("custom protocol reply = %q", reply)
+	}
+
+	// HTTP на том же порту работает как раньше
+	resp, err := http.Get("http://" + addr + "/health")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("HTTP status = %d, want 200", resp.StatusCode)
+	}
+}
+
+// delayGateClock - системные часы, у которых ожидание длительностью gated
+// заканчивается только по сигналу теста
+type delayGateClock struct {
+	realClock
+	gated time.Duration
+	gate  chan time.Time
+}
+
+func (c *delayGateClock) After(d time.Duration) <-chan time.Time {
+	if d == c.gated {
+		return c.gate
+	}
+	return c.realClock.After(d)
+}
+
+func TestPreShutdownDelayKeepsServing(t *testing.T) {
+	config := DefaultConfig()
+	config.PreShutdownDelay = time.Hour
+	um := newTestMultiplexer(t, config)
+	clock := &delayGateClock{gated: time.Hour, gate: make(chan time.Time, 1)}
+	um.clock = clock
+	addr := um.config.Listener.Addr().String()
+	startErr := startTestMultiplexer(t, um)
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- um.Shutdown(context.Background()) }()
+
+	// Без keep-alive: транспорт не открывает запасных соединений, которые
+	// висели бы в матчинге cmux без единого байта и держали Shutdown
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	get := func(path string) int {
+		t.Helper()
+		resp, err := client.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatalf("GET %s during drain delay: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for get("/readyz") != http.StatusServiceUnavailable {
+		if time.Now().After(deadline) {
+			t.Fatal("/readyz still ready after Shutdown started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Пока идет пауза, новые запросы обслуживаются
+	if code := get("/health"); code != http.StatusOK {
+		t.Fatalf("/health = %d during drain delay, want 200", code)
+	}
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown returned before PreShutdownDelay: %v", err)
+	default:
+	}
+
+	clock.gate <- time.Now()
+	if err := <-shutdownErr; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	waitStartReturned(t, startErr)
+}
+
+func TestStartWithoutGRPCClientDegrades(t *testing.T) {
+	config := DefaultConfig()
+	var um *UltraMultiplexer
+	// Проверки готовности идут до LifecycleRunning, клиент моста - после
+	config.Dialer = func(ctx context.Context, addr string) (net.Conn, error) {
+		if um.Lifecycle() == LifecycleRunning {
+			return nil, errors.New("dial refused")
+		}
+		return (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	um = newTestMultiplexer(t, config)
+	addr := um.config.Listener.Addr().String()
+	startTestMultiplexer(t, um)
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	if code, _ := get("/health"); code != http.StatusOK {
+		t.Fatalf("/health = %d, want 200", code)
+	}
+	if code, body := get("/readyz"); code != http.StatusOK || !strings.Contains(body, `"degraded"`) {
+		t.Fatalf("/readyz = %d %s, want 200 degraded", code, body)
+	}
+	if code, _ := get("/grpc-call?name=a"); code != http.StatusServiceUnavailable {
+		t.Fatalf("/grpc-call = %d, want 503", code)
+	}
+}
+
+// breakableListener возвращает из Accept постоянную ошибку после break
+type breakableListener struct {
+	net.Listener
+	broken chan struct{}
+}
+
+var errListenerBroken = errors.New("listener broken")
+
+func (l *breakableListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	select {
+	case <-l.broken:
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, errListenerBroken
+	default:
+	}
+	return conn, err
+}
+
+func TestStartReturnsMuxServeError(t *testing.T) {
+	um := newTestMultiplexer(t, DefaultConfig())
+	listener := &breakableListener{Listener: um.config.Listener, broken: make(chan struct{})}
+	um.UseListener(listener)
+	if err := um.checkMuxServing(); !errors.Is(err, ErrMuxNotServing) {
+		t.Fatalf("checkMuxServing before start = %v, want ErrMuxNotServing", err)
+	}
+	startErr := startTestMultiplexer(t, um)
+	if err := um.checkMuxServing(); err != nil {
+		t.Fatalf("checkMuxServing while running = %v", err)
+	}
+
+	// Соединение будит Accept, и тот возвращает ошибку
+	close(listener.broken)
+	if conn, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+		conn.Close()
+	}
+	err := waitStartReturned(t, startErr)
+	if !errors.Is(err, ErrMuxNotServing) || !errors.Is(err, errListenerBroken) {
+		t.Fatalf("Start = %v, want ErrMuxNotServing wrapping the accept error", err)
+	}
+	if state := um.Lifecycle(); state != LifecycleStopped {
+		t.Fatalf("lifecycle = %s, want stopped", state)
+	}
+}
+
+func TestStartupTimeoutBoundsReadinessWait(t *testing.T) {
+	config := DefaultConfig()
+	config.AuthSkipPaths = nil
+	um := newTestMultiplexer(t, config)
+	// Редкий опрос не растягивает общий бюджет ожидания
+	um.config.ReadinessPollInterval = time.Minute
+	um.config.StartupTimeout = 300 * time.Millisecond
+	um.SetAuthenticator(rejectAllAuthenticator{})
+	if err := um.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	start := time.Now()
+	err := um.Start()
+	if !errors.Is(err, ErrServersNotReady) || !strings.Contains(err.Error(), "HTTP server not ready") {
+		t.Fatalf("Start error = %v, want ErrServersNotReady naming the HTTP server", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Start waited %v with a 300ms startup timeout", elapsed)
+	}
+}
+
+func TestBufconnListener(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	config := DefaultConfig()
+	config.Listener = lis
+	config.Dialer = func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }
+	config.StartupTimeout = 5 * time.Second
+	config.ReadinessPollInterval = 50 * time.Millisecond
+	um := NewUltraMultiplexerWithConfig("0", config)
+	um.RegisterGRPCService(registerPingService)
+	startTestMultiplexer(t, um)
+
+	// Оба протокола ходят через память, без сетевого порта
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) { return lis.DialContext(ctx) },
+	}}
+	resp, err := client.Get("http://bufconn/health")
+	if err != nil {
+		t.Fatalf("GET over bufconn: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/health = %d, want 200", resp.StatusCode)
+	}
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.Invoke(context.Background(), "/ultramux.test.Ping/Ping", &emptypb.Empty{}, &emptypb.Empty{}); err != nil {
+		t.Fatalf("Ping over bufconn: %v", err)
+	}
+}
+
+func TestServeWithListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	config := DefaultConfig()
+	config.StartupTimeout = 5 * time.Second
+	config.ReadinessPollInterval = 50 * time.Millisecond
+	um := NewUltraMultiplexerWithConfig("0", config)
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- um.ServeWithListener(listener) }()
+	deadline := time.Now().Add(10 * time.Second)
+	for um.Lifecycle() != LifecycleRunning {
+		if time.Now().After(deadline) {
+			t.Fatal("multiplexer did not start on the external listener")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	resp, err := http.Get("http://" + listener.Addr().String() + "/health")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+
+	if err := um.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := waitStartReturned(t, serveErr); err != nil {
+		t.Fatalf("ServeWithListener: %v", err)
+	}
+	// Мультиплексор закрывает переданный listener при остановке
+	if _, err := net.DialTimeout("tcp", listener.Addr().String(), time.Second); err == nil {
+		t.Fatal("external listener still accepting after shutdown")
+	}
+}
+
+func TestGRPCMaxConnectionAge(t *testing.T) {
+	config := DefaultConfig()
+	config.GRPCMaxConnectionAge = 300 * time.Millisecond
+	config.GRPCMaxConnectionAgeGrace = 100 * time.Millisecond
+	um := newTestMultiplexer(t, config)
+	um.RegisterGRPCService(registerPingService)
+	addr := um.config.Listener.Addr().String()
+	startTestMultiplexer(t, um)
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := conn.Invoke(ctx, "/ultramux.test.Ping/Ping", &emptypb.Empty{}, &emptypb.Empty{}); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	// По истечении срока сервер шлет GOAWAY и клиент уходит из READY
+	if !conn.WaitForStateChange(ctx, connectivity.Ready) {
+		t.Fatal("connection not closed after GRPCMaxConnectionAge")
+	}
+	// Клиент переподключается и продолжает работать
+	if err := conn.Invoke(ctx, "/ultramux.test.Ping/Ping", &emptypb.Empty{}, &emptypb.Empty{}); err != nil {
+		t.Fatalf("Ping after reconnect: %v", err)
+	}
+}
+
+func TestReadinessCheckBoundsHealthBody(t *testing.T) {
+	um := newTestMultiplexer(t, DefaultConfig())
+	// Неисправный /health отдает тело без конца
+	um.RegisterRoute(Route{Path: "/health", Methods: []string{http.MethodGet}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		chunk := []byte(strings.Repeat("x", 4096))
+		for r.Context().Err() == nil {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	}})
+	startTestMultiplexer(t, um)
+	client := um.readinessClient
+
+	start := time.Now()
+	if !um.checkHTTPReady(context.Background()) {
+		t.Fatal("checkHTTPReady = false for a 200 /health")
+	}
+	// Без лимита чтение шло бы до таймаута клиента (1s)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("checkHTTPReady took %v reading the /health body", elapsed)
+	}
+	if um.readinessClient != client {
+		t.Fatal("readiness client reallocated per check")
+	}
+}
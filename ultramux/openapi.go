@@ -0,0 +1,70 @@
+package ultramux
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RouteParam описывает параметр HTTP эндпоинта для /openapi.json
+type RouteParam struct {
+	Name string
+	// In - расположение параметра: "query" или "header"
+	In          string
+	Description string
+	Required    bool
+}
+
+// anyMethods - во что разворачивается метод "*" в описании
+var anyMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// openAPIDocument строит минимальный OpenAPI 3 документ по реестру маршрутов
+func (h *HTTPHandler) openAPIDocument() map[string]interface{} {
+	paths := make(map[string]interface{}, len(h.paths))
+	for _, path := range h.paths {
+		route := h.routes[path]
+
+		methods := route.Methods
+		if len(methods) == 0 || (len(methods) == 1 && methods[0] == "*") {
+			methods = anyMethods
+		}
+
+		params := make([]map[string]interface{}, 0, len(route.Params))
+		for _, p := range route.Params {
+			params = append(params, map[string]interface{}{
+				"name":        p.Name,
+				"in":          p.In,
+				"description": p.Description,
+				"required":    p.Required,
+				"schema":      map[string]string{"type": "string"},
+			})
+		}
+
+		operations := make(map[string]interface{}, len(methods))
+		for _, method := range methods {
+			operations[strings.ToLower(method)] = map[string]interface{}{
+				"summary":    route.Description,
+				"parameters": params,
+				"responses": map[string]interface{}{
+					"default": map[string]string{"description": "Response"},
+				},
+			}
+		}
+		paths[path] = operations
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":   "Ultra Multiplexer",
+			"version": Version,
+		},
+		"paths": paths,
+	}
+}
+
+func (h *HTTPHandler) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	h.multiplexer.writeJSON(w, 0, h.openAPIDocument())
+}
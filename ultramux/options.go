@@ -0,0 +1,97 @@
+package ultramux
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Option настраивает мультиплексор в NewUltraMultiplexer
+type Option func(*options)
+
+type options struct {
+	port   string
+	config Config
+}
+
+// WithPort задает порт (по умолчанию 8080)
+func WithPort(port string) Option {
+	return func(o *options) { o.port = port }
+}
+
+// WithConfig заменяет конфигурацию целиком; опции после нее применяются поверх
+func WithConfig(config Config) Option {
+	return func(o *options) { o.config = config }
+}
+
+// WithTLS включает TLS на общем порту
+func WithTLS(tlsConfig *TLSConfig) Option {
+	return func(o *options) { o.config.TLS = tlsConfig }
+}
+
+// WithLogger направляет логи этого мультиплексора в logger; стандартный
+// log и другие мультиплексоры процесса не затрагиваются
+func WithLogger(logger *log.Logger) Option {
+	return func(o *options) { o.config.Logger = logger }
+}
+
+// WithProxyAllowlist задает HTTP методы, которые пропускает /proxy
+// (по умолчанию GET и HEAD)
+func WithProxyAllowlist(methods ...string) Option {
+	return func(o *options) { o.config.ProxyAllowedMethods = methods }
+}
+
+// WithProxyTargets задает правила для отдельных upstream
+func WithProxyTargets(targets ...ProxyTarget) Option {
+	return func(o *options) { o.config.ProxyTargets = targets }
+}
+
+// WithTimeouts задает таймауты остановки и моста; нулевые значения
+// оставляют текущие
+func WithTimeouts(shutdown, grpcDrain, bridge time.Duration) Option {
+	return func(o *options) {
+		if shutdown > 0 {
+			o.config.ShutdownTimeout = shutdown
+		}
+		if grpcDrain > 0 {
+			o.config.GRPCDrainTimeout = grpcDrain
+		}
+		if bridge > 0 {
+			o.config.BridgeMaxTimeout = bridge
+		}
+	}
+}
+
+// WithStartupTimeout задает частоту опроса готовности и общий бюджет
+// ожидания при старте; нулевые значения оставляют текущие
+func WithStartupTimeout(pollInterval, timeout time.Duration) Option {
+	return func(o *options) {
+		if pollInterval > 0 {
+			o.config.ReadinessPollInterval = pollInterval
+		}
+		if timeout > 0 {
+			o.config.StartupTimeout = timeout
+		}
+	}
+}
+
+// WithListener использует готовый listener вместо net.Listen
+func WithListener(listener net.Listener) Option {
+	return func(o *options) { o.config.Listener = listener }
+}
+
+// WithHTTPClient задает клиент для /proxy
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) { o.config.HTTPClient = client }
+}
+
+// WithClock подменяет источник времени (тесты)
+func WithClock(clock Clock) Option {
+	return func(o *options) { o.config.Clock = clock }
+}
+
+// WithDebug включает отладочные возможности (DebugService, логирование тел, chaos)
+func WithDebug() Option {
+	return func(o *options) { o.config.DebugEnabled = true }
+}
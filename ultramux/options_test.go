@@ -0,0 +1,37 @@
+package ultramux
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithLoggerKeepsStandardLog(t *testing.T) {
+	stdOut, stdFlags, stdPrefix := log.Writer(), log.Flags(), log.Prefix()
+
+	var first, second bytes.Buffer
+	um1 := NewUltraMultiplexer(WithLogger(log.New(&first, "first ", 0)))
+	um2 := NewUltraMultiplexer(WithLogger(log.New(&second, "second ", 0)))
+
+	if log.Writer() != stdOut || log.Flags() != stdFlags || log.Prefix() != stdPrefix {
+		t.Fatal("WithLogger changed the standard logger")
+	}
+
+	um1.SetEndpointEnabled("/proxy", false)
+	um2.SetEndpointEnabled("/stats", false)
+	if got := first.String(); !strings.HasPrefix(got, "first ") || !strings.Contains(got, "/proxy") {
+		t.Fatalf("first logger got %q", got)
+	}
+	if got := second.String(); !strings.HasPrefix(got, "second ") || !strings.Contains(got, "/stats") {
+		t.Fatalf("second logger got %q", got)
+	}
+}
+
+func TestWithStartupTimeout(t *testing.T) {
+	um := NewUltraMultiplexer(WithStartupTimeout(0, time.Minute))
+	if um.config.ReadinessPollInterval != DefaultConfig().ReadinessPollInterval || um.config.StartupTimeout != time.Minute {
+		t.Fatalf("poll %v, timeout %v; want default poll and 1m", um.config.ReadinessPollInterval, um.config.StartupTimeout)
+	}
+}
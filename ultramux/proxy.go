@@ -0,0 +1,694 @@
+package ultramux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hop-by-hop заголовки (RFC 7230, раздел 6.1) относятся к конкретному
+// соединению и не должны пересылаться прокси. Transfer-Encoding в том числе:
+// фреймингом ответа клиенту управляет сам net/http.
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Заголовки клиента в чужой upstream не пересылаются, кроме описания тела
+// и заголовков, меняющих семантику запроса (Range для докачки)
+var forwardedRequestHeaders = []string{
+	"Content-Type",
+	"Range",
+	"If-Range",
+}
+
+// ProxyTarget задает настройки /proxy для конкретного upstream
+type ProxyTarget struct {
+	// Host upstream'а, как в URL (с портом, если он нестандартный)
+	Host string
+	// PathPrefix сужает правило до путей с этим префиксом
+	PathPrefix string
+	// AllowedMethods переопределяет Config.ProxyAllowedMethods
+	AllowedMethods []string
+	// Redirects переопределяет Config.ProxyRedirects
+	Redirects *RedirectPolicy
+	// MaxResponseBytes переопределяет Config.ProxyMaxResponseBytes
+	MaxResponseBytes int64
+	// AllowedContentTypes переопределяет Config.ProxyAllowedContentTypes
+	AllowedContentTypes []string
+	// Rewrite переписывает путь перед отправкой в upstream
+	Rewrite *PathRewrite
+	// TLS - свой CA, клиентский сертификат или отключение проверки для
+	// upstream. Транспорт HTTPClient (должен быть *http.Transport)
+	// клонируется, меняется только TLSClientConfig
+	TLS *UpstreamTLS
+	// HostMode выбирает заголовок Host для upstream; пустой - HostTarget
+	HostMode HostHeaderMode
+	// HostHeader - значение Host для HostFixed
+	HostHeader string
+	// Timeout заменяет HTTPClient.Timeout для этого upstream (вся загрузка,
+	// включая тело ответа). 0 - таймаут клиента
+	Timeout time.Duration
+}
+
+// HostHeaderMode - откуда берется заголовок Host запроса в upstream.
+// Нужен для виртуальных хостов за одним адресом
+type HostHeaderMode string
+
+const (
+	HostTarget   HostHeaderMode = "target"   // хост из target URL
+	HostPreserve HostHeaderMode = "preserve" // Host исходного запроса клиента
+	HostFixed    HostHeaderMode = "fixed"    // ProxyTarget.HostHeader
+)
+
+// PathRewrite описывает перезапись пути. Если задан Pattern, путь
+// заменяется регулярным выражением (Replacement поддерживает $1, ${name});
+// иначе снимается StripPrefix и добавляется AddPrefix.
+type PathRewrite struct {
+	// StripPrefix снимается, только если путь равен ему или продолжается с "/"
+	StripPrefix string
+	AddPrefix   string
+	Pattern     string
+	Replacement string
+}
+
+func (um *UltraMultiplexer) rewritePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := um.rewriteCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	um.rewriteCache.Store(pattern, re)
+	return re, nil
+}
+
+// validateProxyTargets компилирует шаблоны перезаписи заранее, чтобы
+// ошибки конфигурации всплывали в Initialize, а не на первом запросе
+func (um *UltraMultiplexer) validateProxyTargets() error {
+	if target := um.config.ProxyDefaultTarget; target != "" {
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: proxy default target %q must be an absolute http(s) URL", ErrInvalidConfig, target)
+		}
+	}
+	for _, t := range um.config.ProxyTargets {
+		switch t.HostMode {
+		case "", HostTarget, HostPreserve:
+		case HostFixed:
+			if t.HostHeader == "" {
+				return fmt.Errorf("%w: proxy target %s%s: host mode %q requires HostHeader", ErrInvalidConfig, t.Host, t.PathPrefix, t.HostMode)
+			}
+		default:
+			return fmt.Errorf("%w: proxy target %s%s: unknown host mode %q", ErrInvalidConfig, t.Host, t.PathPrefix, t.HostMode)
+		}
+		if t.Rewrite == nil || t.Rewrite.Pattern == "" {
+			continue
+		}
+		if _, err := um.rewritePattern(t.Rewrite.Pattern); err != nil {
+			return fmt.Errorf("%w: proxy target %s%s: bad rewrite pattern: %w", ErrInvalidConfig, t.Host, t.PathPrefix, err)
+		}
+	}
+	return um.buildProxyTransports()
+}
+
+func (um *UltraMultiplexer) rewritePath(rw *PathRewrite, path string) string {
+	if rw.Pattern != "" {
+		re, err := um.rewritePattern(rw.Pattern)
+		if err != nil {
+			return path
+		}
+		return re.ReplaceAllString(path, rw.Replacement)
+	}
+
+	// Префикс снимается только по границе сегмента: /api не трогает /apiv2
+	if prefix := strings.TrimSuffix(rw.StripPrefix, "/"); prefix != "" &&
+		(path == prefix || strings.HasPrefix(path, prefix+"/")) {
+		path = path[len(prefix):]
+	}
+	path = rw.AddPrefix + path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+func (um *UltraMultiplexer) proxyMaxResponseBytes(t *ProxyTarget) int64 {
+	if t != nil && t.MaxResponseBytes > 0 {
+		return t.MaxResponseBytes
+	}
+	return um.config.ProxyMaxResponseBytes
+}
+
+func (um *UltraMultiplexer) proxyAllowedContentTypes(t *ProxyTarget) []string {
+	if t != nil && len(t.AllowedContentTypes) > 0 {
+		return t.AllowedContentTypes
+	}
+	return um.config.ProxyAllowedContentTypes
+}
+
+// contentTypeAllowed сравнивает media type ответа со списком; поддерживаются
+// шаблоны вида "text/*". Пустой список разрешает все
+func contentTypeAllowed(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == mediaType || pattern == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// RedirectPolicy управляет следованием редиректам upstream'а в /proxy
+type RedirectPolicy struct {
+	// NoFollow: редирект не выполняется, 3xx ответ отдается клиенту как есть
+	NoFollow bool
+	// MaxRedirects - лимит редиректов; 0 - стандартные для net/http 10
+	MaxRedirects int
+}
+
+func (p RedirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if p.NoFollow {
+		return http.ErrUseLastResponse
+	}
+
+	limit := p.MaxRedirects
+	if limit <= 0 {
+		limit = 10
+	}
+	// via - уже выполненные запросы, len(via) - номер текущего редиректа
+	if len(via) > limit {
+		return fmt.Errorf("stopped after %d redirects", limit)
+	}
+	return nil
+}
+
+func (um *UltraMultiplexer) proxyRedirectPolicy(t *ProxyTarget) RedirectPolicy {
+	if t != nil && t.Redirects != nil {
+		return *t.Redirects
+	}
+	return um.config.ProxyRedirects
+}
+
+// proxyTargetFor ищет правило для URL; при нескольких совпадениях
+// побеждает самый длинный PathPrefix
+func (um *UltraMultiplexer) proxyTargetFor(u *url.URL) *ProxyTarget {
+	var best *ProxyTarget
+	for i := range um.config.ProxyTargets {
+		t := &um.config.ProxyTargets[i]
+		if !strings.EqualFold(t.Host, u.Host) || !strings.HasPrefix(u.Path, t.PathPrefix) {
+			continue
+		}
+		if best == nil || len(t.PathPrefix) > len(best.PathPrefix) {
+			best = t
+		}
+	}
+	return best
+}
+
+// defaultProxyMethods - /proxy только читает, пока методы не заданы явно
+var defaultProxyMethods = []string{http.MethodGet, http.MethodHead}
+
+// proxyAllowedMethods: правило target приоритетнее арендатора, арендатор - глобального списка
+func (um *UltraMultiplexer) proxyAllowedMethods(r *http.Request, t *ProxyTarget) []string {
+	if t != nil && len(t.AllowedMethods) > 0 {
+		return t.AllowedMethods
+	}
+	if _, tenant := tenantFromContext(r.Context()); tenant != nil && len(tenant.ProxyAllowedMethods) > 0 {
+		return tenant.ProxyAllowedMethods
+	}
+	if len(um.config.ProxyAllowedMethods) > 0 {
+		return um.config.ProxyAllowedMethods
+	}
+	return defaultProxyMethods
+}
+
+func methodAllowed(method string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, m := range allowed {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *HTTPHandler) proxyRequest(w http.ResponseWriter, r *http.Request) {
+	if !h.multiplexer.acquireProxySlot() {
+		h.multiplexer.metrics.Inc("proxy_concurrency_rejected_total")
+		w.Header().Set("Retry-After", "1")
+		h.multiplexer.writeError(w, r, http.StatusServiceUnavailable, "too many concurrent proxy requests")
+		return
+	}
+	defer h.multiplexer.releaseProxySlot()
+
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		target = h.multiplexer.config.ProxyDefaultTarget
+	}
+	if target == "" {
+		h.multiplexer.writeError(w, r, http.StatusBadRequest, "target parameter required")
+		return
+	}
+
+	targetURL, err := url.Parse(target)
+	if err != nil || (targetURL.Scheme != "http" && targetURL.Scheme != "https") || targetURL.Host == "" {
+		h.multiplexer.writeError(w, r, http.StatusBadRequest, "target must be an absolute http(s) URL")
+		return
+	}
+
+	rule := h.multiplexer.proxyTargetFor(targetURL)
+	if allowed := h.multiplexer.proxyAllowedMethods(r, rule); !methodAllowed(r.Method, allowed) {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		h.multiplexer.writeError(w, r, http.StatusMethodNotAllowed, "method not allowed for proxy")
+		return
+	}
+
+	if rule != nil && rule.Rewrite != nil {
+		targetURL.Path = h.multiplexer.rewritePath(rule.Rewrite, targetURL.Path)
+		targetURL.RawPath = ""
+	}
+
+	ctx := r.Context()
+	if rule != nil && rule.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rule.Timeout)
+		defer cancel()
+	}
+
+	outReq, err := http.NewRequestWithContext(ctx, r.Method, targetURL.String(), r.Body)
+	if err != nil {
+		h.multiplexer.writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, key := range forwardedRequestHeaders {
+		if values := r.Header.Values(key); len(values) > 0 {
+			outReq.Header[key] = values
+		}
+	}
+	outReq.ContentLength = r.ContentLength
+	// Expect: 100-continue передаем upstream'у: транспорт ждет его 100 Continue
+	// и только тогда читает тело, а net/http отправляет клиенту 100 Continue
+	// при первом чтении тела. Если upstream сразу ответит ошибкой, тело не
+	// передается вовсе
+	if r.ContentLength != 0 && strings.EqualFold(r.Header.Get("Expect"), "100-continue") {
+		outReq.Header.Set("Expect", "100-continue")
+		h.multiplexer.metrics.Inc("proxy_expect_continue_total")
+	}
+	// Трейлеры запроса заполняются, когда тело дочитано; транспорт прочитает
+	// их из той же map после отправки тела
+	if len(r.Trailer) > 0 {
+		outReq.Trailer = r.Trailer
+	}
+	h.multiplexer.setProxyIdentity(outReq, r)
+	setProxyHost(outReq, r, rule)
+
+	cache := h.multiplexer.proxyCache
+	cacheKey := proxyCacheKey(outReq)
+	var cached *proxyCacheEntry
+	if cache.cacheableRequest(r) {
+		var fresh bool
+		cached, fresh = cache.lookup(cacheKey)
+		if fresh && !hasCacheDirective(r.Header, "no-cache") {
+			h.multiplexer.serveCached(w, r, cached, "HIT")
+			return
+		}
+		if cached != nil {
+			// Устаревшую запись перепроверяем условным запросом
+			cached.setValidators(outReq)
+		}
+	}
+
+	bodyLog := h.multiplexer.newProxyBodyLogger()
+	if bodyLog != nil {
+		bodyLog.wrapRequest(outReq)
+	}
+
+	// Повторять безопасно только идемпотентные запросы без тела
+	maxRetries := 0
+	if isIdempotent(r.Method) && r.ContentLength == 0 {
+		maxRetries = h.multiplexer.config.ProxyMaxRetries
+	}
+
+	// Копия клиента с политикой редиректов для этого target; сам клиент
+	// (в том числе подмененный через SetHTTPClient) не меняем
+	client := *h.multiplexer.getHTTPClient()
+	client.CheckRedirect = h.multiplexer.proxyRedirectPolicy(rule).checkRedirect
+	transport, err := h.multiplexer.proxyTransport(rule, &client)
+	if err != nil {
+		h.multiplexer.logger.Printf("❌ %v", err)
+		h.multiplexer.writeError(w, r, http.StatusBadGateway, "proxy target TLS is misconfigured")
+		return
+	}
+	if transport != nil {
+		client.Transport = transport
+	}
+	if rule != nil && rule.Timeout > 0 {
+		// Дедлайн уже в контексте запроса и может быть больше общего
+		client.Timeout = 0
+	}
+	var resp *http.Response
+	h.multiplexer.withRetries(r.Context(), maxRetries, func() bool {
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		resp, err = client.Do(outReq)
+		return err != nil || isRetryableStatus(resp.StatusCode)
+	})
+	if err != nil {
+		code, reason := classifyUpstreamError(err)
+		h.multiplexer.logger.Printf("⚠️ Proxy to %s failed (%s): %v", targetURL.Host, reason, err)
+		h.multiplexer.metrics.Inc("proxy_upstream_" + reason + "_total")
+		h.multiplexer.writeError(w, r, code, "upstream "+strings.ReplaceAll(reason, "_", " ")+": "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		h.multiplexer.serveCached(w, r, cache.refresh(cacheKey, cached, resp.Header), "REVALIDATED")
+		return
+	}
+
+	maxBytes := h.multiplexer.proxyMaxResponseBytes(rule)
+	if maxBytes > 0 && resp.ContentLength > maxBytes {
+		// Размер известен заранее - отказываем, пока клиенту ничего не отправлено
+		h.multiplexer.logger.Printf("⚠️ Proxy response from %s too large: %d bytes (limit %d)", targetURL.Host, resp.ContentLength, maxBytes)
+		h.multiplexer.metrics.Inc("proxy_response_too_large_total")
+		h.multiplexer.writeError(w, r, http.StatusBadGateway, "upstream response too large")
+		return
+	}
+
+	// Пустые ответы (204, 304, HEAD) пропускаем без проверки типа
+	if resp.ContentLength != 0 && r.Method != http.MethodHead {
+		if contentType := resp.Header.Get("Content-Type"); !contentTypeAllowed(contentType, h.multiplexer.proxyAllowedContentTypes(rule)) {
+			h.multiplexer.logger.Printf("⚠️ Proxy response from %s blocked: content type %q not allowed", targetURL.Host, contentType)
+			h.multiplexer.metrics.Inc("proxy_content_type_blocked_total")
+			h.multiplexer.writeError(w, r, http.StatusBadGateway, "upstream content type not allowed")
+			return
+		}
+	}
+
+	upstreamBody := resp.Body
+	if err := h.multiplexer.transformResponse(resp); err != nil {
+		h.multiplexer.logger.Printf("⚠️ Proxy response from %s transform failed: %v", targetURL.Host, err)
+		h.multiplexer.metrics.Inc("proxy_transform_errors_total")
+		h.multiplexer.writeError(w, r, http.StatusBadGateway, "response transform failed")
+		return
+	}
+	if resp.Body != upstreamBody {
+		defer resp.Body.Close()
+	}
+
+	if bodyLog != nil {
+		bodyLog.wrapResponse(resp)
+		defer bodyLog.log(r.Method, targetURL.String(), resp.StatusCode)
+	}
+
+	var body io.Reader = resp.Body
+	var contentLength string
+	if h.multiplexer.bufferableResponse(r, resp) {
+		buffered, complete, err := readUpTo(resp.Body, h.multiplexer.config.ProxyBufferThreshold)
+		if err != nil {
+			h.multiplexer.logger.Printf("⚠️ Proxy response from %s failed while buffering: %v", targetURL.Host, err)
+			h.multiplexer.metrics.Inc("proxy_upstream_error_total")
+			h.multiplexer.writeError(w, r, http.StatusBadGateway, "upstream error: "+err.Error())
+			return
+		}
+		if complete {
+			if maxBytes > 0 && int64(len(buffered)) > maxBytes {
+				h.multiplexer.logger.Printf("⚠️ Proxy response from %s too large: %d bytes (limit %d)", targetURL.Host, len(buffered), maxBytes)
+				h.multiplexer.metrics.Inc("proxy_response_too_large_total")
+				h.multiplexer.writeError(w, r, http.StatusBadGateway, "upstream response too large")
+				return
+			}
+			contentLength = strconv.Itoa(len(buffered))
+			h.multiplexer.metrics.Inc("proxy_response_buffered_total")
+		}
+		body = io.MultiReader(bytes.NewReader(buffered), resp.Body)
+	}
+
+	// Тело копируется в кэш по ходу отдачи клиенту и сохраняется, только
+	// если дочитано целиком
+	var capture *cacheCapture
+	if resp.StatusCode == http.StatusOK && cache.cacheableRequest(r) {
+		capture = &cacheCapture{limit: cache.cfg.MaxBodyBytes}
+		body = io.TeeReader(body, capture)
+		w.Header().Set("X-Cache", "MISS")
+		h.multiplexer.metrics.Inc("proxy_cache_miss_total")
+	}
+	finish := func() {
+		copyTrailers(w.Header(), resp.Trailer)
+		if capture != nil && !capture.overflow {
+			cache.store(cacheKey, resp.StatusCode, resp.Header, capture.buf)
+		}
+	}
+
+	copyHeader(w.Header(), resp.Header)
+	announceTrailers(w.Header(), resp.Trailer)
+	if contentLength != "" {
+		w.Header().Set("Content-Length", contentLength)
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	if maxBytes <= 0 {
+		if !h.multiplexer.copyProxyBody(w, body, r, targetURL) {
+			return
+		}
+		finish()
+		return
+	}
+
+	if !h.multiplexer.copyProxyBody(w, io.LimitReader(body, maxBytes), r, targetURL) {
+		return
+	}
+	// Статус уже отправлен: обрываем соединение (HTTP/2 - поток), чтобы
+	// клиент увидел ошибку, а не принял обрезанное тело за полное
+	if n, _ := body.Read(make([]byte, 1)); n > 0 {
+		h.multiplexer.logger.Printf("⚠️ Proxy response from %s truncated at %d bytes, aborting", targetURL.Host, maxBytes)
+		h.multiplexer.metrics.Inc("proxy_response_truncated_total")
+		panic(http.ErrAbortHandler)
+	}
+	finish()
+}
+
+// streamingContentTypes - потоковые ответы: события в них должны уходить
+// клиенту сразу, а не копиться до ProxyBufferThreshold
+var streamingContentTypes = []string{
+	"text/event-stream",
+	"application/x-ndjson",
+	"application/stream+json",
+	"application/grpc",
+	"multipart/x-mixed-replace",
+}
+
+// bufferableResponse: буферизуем только ответы без известной длины
+// (chunked), с телом и без трейлеров - им нужен chunked и в сторону
+// клиента. Потоковые типы не буферизуем никогда
+func (um *UltraMultiplexer) bufferableResponse(r *http.Request, resp *http.Response) bool {
+	if um.config.ProxyBufferThreshold <= 0 || resp.ContentLength >= 0 || len(resp.Trailer) > 0 {
+		return false
+	}
+	if contentTypeAllowed(resp.Header.Get("Content-Type"), streamingContentTypes) {
+		return false
+	}
+	if r.Method == http.MethodHead || resp.StatusCode < 200 ||
+		resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return false
+	}
+	return true
+}
+
+// readUpTo читает тело, пока оно укладывается в limit байт. complete -
+// тело дочитано целиком; иначе в буфере первые limit+1 байт
+func readUpTo(body io.Reader, limit int) (buf []byte, complete bool, err error) {
+	buf, err = io.ReadAll(io.LimitReader(body, int64(limit)+1))
+	if err != nil {
+		return nil, false, err
+	}
+	return buf, len(buf) <= limit, nil
+}
+
+// copyProxyBody копирует тело ответа клиенту. Статус к этому моменту уже
+// отправлен, поэтому обрыв (ушел клиент, upstream сбросил соединение)
+// можно только залогировать; false - ответ оборван
+func (um *UltraMultiplexer) copyProxyBody(w io.Writer, body io.Reader, r *http.Request, targetURL *url.URL) bool {
+	n, err := io.Copy(w, body)
+	if err == nil {
+		return true
+	}
+
+	reason := "upstream"
+	if r.Context().Err() != nil {
+		reason = "client"
+	}
+	um.logger.Printf("⚠️ Proxy response from %s interrupted after %d bytes (%s, request_id=%s): %v",
+		targetURL.Host, n, reason, RequestIDFromContext(r.Context()), err)
+	um.metrics.Inc("proxy_response_interrupted_total")
+	return false
+}
+
+// acquireProxySlot занимает место в семафоре ProxyMaxConcurrent без ожидания
+func (um *UltraMultiplexer) acquireProxySlot() bool {
+	if um.proxySlots != nil {
+		select {
+		case um.proxySlots <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	um.proxyInFlight.Add(1)
+	return true
+}
+
+func (um *UltraMultiplexer) releaseProxySlot() {
+	um.proxyInFlight.Add(-1)
+	if um.proxySlots != nil {
+		<-um.proxySlots
+	}
+}
+
+// announceTrailers объявляет трейлеры upstream до WriteHeader; значения
+// станут известны только после чтения тела
+func announceTrailers(dst, trailer http.Header) {
+	for key := range trailer {
+		dst.Add("Trailer", key)
+	}
+}
+
+// copyTrailers переносит трейлеры upstream после тела. Объявленные ключи
+// net/http отправит как трейлеры; пришедшие без объявления передаем через
+// http.TrailerPrefix
+func copyTrailers(dst, trailer http.Header) {
+	announced := make(map[string]bool)
+	for _, value := range dst.Values("Trailer") {
+		for _, key := range strings.Split(value, ",") {
+			announced[http.CanonicalHeaderKey(strings.TrimSpace(key))] = true
+		}
+	}
+
+	for key, values := range trailer {
+		if !announced[key] {
+			key = http.TrailerPrefix + key
+		}
+		dst[key] = values
+	}
+}
+
+// setProxyIdentity задает User-Agent и дописывает себя в Via (RFC 7230, 5.7.1)
+func (um *UltraMultiplexer) setProxyIdentity(outReq, r *http.Request) {
+	if ua := um.config.ProxyUserAgent; ua != "" {
+		outReq.Header.Set("User-Agent", ua)
+	}
+
+	if pseudonym := um.config.ProxyVia; pseudonym != "" {
+		protocol := fmt.Sprintf("%d.%d", r.ProtoMajor, r.ProtoMinor)
+		if r.ProtoMajor >= 2 {
+			protocol = strconv.Itoa(r.ProtoMajor)
+		}
+		via := append(r.Header.Values("Via"), protocol+" "+pseudonym)
+		outReq.Header.Set("Via", strings.Join(via, ", "))
+	}
+}
+
+// setProxyHost выставляет Host по режиму правила. Соединение все равно
+// устанавливается с хостом из target URL
+func setProxyHost(outReq, r *http.Request, t *ProxyTarget) {
+	if t == nil {
+		return
+	}
+	switch t.HostMode {
+	case HostPreserve:
+		outReq.Host = r.Host
+	case HostFixed:
+		outReq.Host = t.HostHeader
+	}
+}
+
+// classifyUpstreamError различает причины отказа upstream: имя не
+// разрешается (обычно ошибка конфигурации), соединение не устанавливается
+// (upstream лежит) и таймаут
+func classifyUpstreamError(err error) (int, string) {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return 499, "canceled"
+	case errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err):
+		return http.StatusGatewayTimeout, "timeout"
+	case errors.As(err, &dnsErr):
+		return http.StatusBadGateway, "dns_failure"
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return http.StatusBadGateway, "connection_failure"
+	default:
+		return http.StatusBadGateway, "error"
+	}
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// copyHeader копирует заголовки, пропуская hop-by-hop
+func copyHeader(dst, src http.Header) {
+	skip := make(map[string]bool, len(hopHeaders))
+	for _, key := range hopHeaders {
+		skip[key] = true
+	}
+	// Заголовки, перечисленные в Connection, тоже hop-by-hop
+	for _, value := range src.Values("Connection") {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				skip[http.CanonicalHeaderKey(field)] = true
+			}
+		}
+	}
+
+	for key, values := range src {
+		if skip[key] {
+			continue
+		}
+		for _, value := range values {
+			dst.Add(key, value)
+		}
+	}
+}
@@ -0,0 +1,758 @@
+package ultramux
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProxyChunkedUpstream(t *testing.T) {
+	chunks := []string{`{"items":[`, `{"id":1},`, `{"id":2}`, `]}`}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		for _, chunk := range chunks {
+			io.WriteString(w, chunk)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer upstream.Close()
+
+	um := newTestMultiplexer(t, DefaultConfig())
+	addr := um.config.Listener.Addr().String()
+	startTestMultiplexer(t, um)
+
+	// Сырой ответ: фрейминг выбирает net/http (chunked или, для короткого
+	// ответа, Content-Length); Transfer-Encoding upstream'а не копируется
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	fmt.Fprintf(conn, "GET /proxy?target=%s HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n",
+		url.QueryEscape(upstream.URL+"/items"), addr)
+	raw, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	head, _, _ := bytes.Cut(raw, []byte("\r\n\r\n"))
+	if n := strings.Count(strings.ToLower(string(head)), "transfer-encoding:"); n > 1 {
+		t.Fatalf("Transfer-Encoding header appears %d times:\n%s", n, head)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), nil)
+	if err != nil {
+		t.Fatalf("malformed response: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, body %s", resp.StatusCode, body)
+	}
+	if want := strings.Join(chunks, ""); string(body) != want {
+		t.Fatalf("body = %q, want %q", body, want)
+	}
+}
+
+func TestCopyHeaderSkipsHopByHop(t *testing.T) {
+	src := http.Header{
+		"Content-Type":      {"application/json"},
+		"Transfer-Encoding": {"chunked"},
+		"Connection":        {"keep-alive"},
+	}
+	dst := http.Header{}
+	copyHeader(dst, src)
+
+	if got := dst.Get("Content-Type"); got != "application/json" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+	for _, key := range []string{"Transfer-Encoding", "Connection"} {
+		if _, ok := dst[key]; ok {
+			t.Fatalf("%s forwarded: %v", key, dst)
+		}
+	}
+}
+
+func TestProxyAbortsOversizedChunkedResponse(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunk := strings.Repeat("x", 1024)
+		for i := 0; i < 64; i++ {
+			io.WriteString(w, chunk)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer upstream.Close()
+
+	config := DefaultConfig()
+	config.ProxyMaxResponseBytes = 4096
+	um := newTestMultiplexer(t, config)
+	addr := um.config.Listener.Addr().String()
+	startTestMultiplexer(t, um)
+
+	resp, err := http.Get("http://" + addr + "/proxy?target=" + url.QueryEscape(upstream.URL))
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err == nil {
+		t.Fatalf("truncated body of %d bytes read without error", len(body))
+	}
+
+	// Оборванный запрос остается в /admin/requests
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		for _, entry := range um.requestLog.snapshot() {
+			if entry.Path == "/proxy" {
+				if !entry.Aborted || entry.Status != "200" {
+					t.Fatalf("request log entry = %+v, want aborted 200", entry)
+				}
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("aborted /proxy request missing from the request log")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRewritePathStripPrefixSegmentBoundary(t *testing.T) {
+	um := NewUltraMultiplexer()
+	tests := []struct {
+		strip, path, want string
+	}{
+		{"/api", "/api/x", "/x"},
+		{"/api", "/api", "/"},
+		{"/api/", "/api/x", "/x"},
+		{"/api", "/apiv2/x", "/apiv2/x"},
+		{"/api", "/other", "/other"},
+	}
+	for _, tt := range tests {
+		if got := um.rewritePath(&PathRewrite{StripPrefix: tt.strip}, tt.path); got != tt.want {
+			t.Errorf("rewritePath(%q, %q) = %q, want %q", tt.strip, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestProxyTargetTLSKeepsClientTransport(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure")
+	}))
+	defer upstream.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw}), 0o600); err != nil {
+		t.Fatalf("write CA: %v", err)
+	}
+
+	config := DefaultConfig()
+	config.ProxyTargets = []ProxyTarget{{Host: upstream.Listener.Addr().String(), TLS: &UpstreamTLS{CAFile: caFile}}}
+	um := newTestMultiplexer(t, config)
+
+	// Транспорт клиента с собственным dial: он должен использоваться и
+	// для target'а со своим TLS
+	var dials atomic.Int64
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials.Add(1)
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+	um.SetHTTPClient(&http.Client{Transport: transport})
+	addr := um.config.Listener.Addr().String()
+	startTestMultiplexer(t, um)
+
+	resp, err := http.Get("http://" + addr + "/proxy?target=" + url.QueryEscape(upstream.URL))
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "secure" {
+		t.Fatalf("status = %d, body %q", resp.StatusCode, body)
+	}
+	if dials.Load() == 0 {
+		t.Fatal("client transport was bypassed for the TLS target")
+	}
+}
+
+func TestProxyTransportResponseHeaderTimeout(t *testing.T) {
+	um := NewUltraMultiplexer()
+	target := &ProxyTarget{Host: "a.example"}
+	um.proxyTLS = map[*ProxyTarget]*tls.Config{target: {}}
+	um.proxyTransports = make(map[*ProxyTarget]*http.Transport)
+	um.proxyTransportBases = make(map[*ProxyTarget]*http.Transport)
+
+	transport, err := um.proxyTransport(target, &http.Client{Transport: &http.Transport{}})
+	if err != nil {
+		t.Fatalf("proxyTransport: %v", err)
+	}
+	if transport.ResponseHeaderTimeout != defaultResponseHeaderTimeout {
+		t.Fatalf("ResponseHeaderTimeout = %v, want %v", transport.ResponseHeaderTimeout, defaultResponseHeaderTimeout)
+	}
+
+	transport, err = um.proxyTransport(target, &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: time.Second}})
+	if err != nil {
+		t.Fatalf("proxyTransport: %v", err)
+	}
+	if transport.ResponseHeaderTimeout != time.Second {
+		t.Fatalf("ResponseHeaderTimeout = %v, want the client's 1s", transport.ResponseHeaderTimeout)
+	}
+
+	if _, err := um.proxyTransport(target, &http.Client{Transport: roundTripperFunc(nil)}); err == nil {
+		t.Fatal("non-*http.Transport client accepted for a TLS target")
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestProxyAllowedMethods(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Method)
+	}))
+	defer upstream.Close()
+
+	config := DefaultConfig()
+	config.ProxyDefaultTarget = upstream.URL + "/"
+	config.ProxyTargets = []ProxyTarget{{
+		Host:           upstream.Listener.Addr().String(),
+		PathPrefix:     "/write",
+		AllowedMethods: []string{http.MethodPost},
+	}}
+	handler := newHTTPHandler(NewUltraMultiplexer(WithConfig(config)), nil)
+
+	tests := []struct {
+		name      string
+		method    string
+		target    string
+		tenant    *Tenant
+		want      int
+		wantAllow string
+	}{
+		{"default target GET", http.MethodGet, "", nil, http.StatusOK, ""},
+		{"read-only by default", http.MethodPost, upstream.URL + "/", nil, http.StatusMethodNotAllowed, "GET, HEAD"},
+		{"target override allows", http.MethodPost, upstream.URL + "/write/x", nil, http.StatusOK, ""},
+		{"target override replaces default", http.MethodGet, upstream.URL + "/write/x", nil, http.StatusMethodNotAllowed, "POST"},
+		{"tenant list", http.MethodPut, upstream.URL + "/", &Tenant{ProxyAllowedMethods: []string{http.MethodPut}}, http.StatusOK, ""},
+		{"target beats tenant", http.MethodPut, upstream.URL + "/write", &Tenant{ProxyAllowedMethods: []string{http.MethodPut}}, http.StatusMethodNotAllowed, "POST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := "/proxy"
+			if tt.target != "" {
+				target += "?target=" + url.QueryEscape(tt.target)
+			}
+			req := httptest.NewRequest(tt.method, target, nil)
+			if tt.tenant != nil {
+				req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, &tenantInfo{name: "a.example", tenant: *tt.tenant}))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.want, rec.Body)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.wantAllow {
+				t.Fatalf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+			if tt.want == http.StatusOK && rec.Body.String() != tt.method {
+				t.Fatalf("upstream saw %q, want %q", rec.Body, tt.method)
+			}
+		})
+	}
+}
+
+func TestProxyRedirectPolicy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hop2":
+			http.Redirect(w, r, "/hop1", http.StatusFound)
+		case "/hop1":
+			http.Redirect(w, r, "/final", http.StatusFound)
+		default:
+			io.WriteString(w, "final")
+		}
+	}))
+	defer upstream.Close()
+	host := upstream.Listener.Addr().String()
+
+	tests := []struct {
+		name         string
+		global       RedirectPolicy
+		target       *RedirectPolicy
+		path         string
+		want         int
+		wantLocation string
+	}{
+		{"follow by default", RedirectPolicy{}, nil, "/hop2", http.StatusOK, ""},
+		{"pass-through", RedirectPolicy{NoFollow: true}, nil, "/hop2", http.StatusFound, "/hop1"},
+		{"limit exceeded", RedirectPolicy{MaxRedirects: 1}, nil, "/hop2", http.StatusBadGateway, ""},
+		{"within limit", RedirectPolicy{MaxRedirects: 1}, nil, "/hop1", http.StatusOK, ""},
+		{"target overrides global", RedirectPolicy{NoFollow: true}, &RedirectPolicy{}, "/hop2", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.ProxyRedirects = tt.global
+			if tt.target != nil {
+				config.ProxyTargets = []ProxyTarget{{Host: host, Redirects: tt.target}}
+			}
+			handler := newHTTPHandler(NewUltraMultiplexer(WithConfig(config)), nil)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy?target="+url.QueryEscape(upstream.URL+tt.path), nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.want, rec.Body)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Fatalf("Location = %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestClassifyUpstreamError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantReason string
+	}{
+		{"canceled", fmt.Errorf("get: %w", context.Canceled), 499, "canceled"},
+		{"deadline", fmt.Errorf("get: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, "timeout"},
+		{"dns", &url.Error{Op: "Get", Err: &net.DNSError{Err: "no such host", Name: "nope.invalid"}}, http.StatusBadGateway, "dns_failure"},
+		{"dial", &url.Error{Op: "Get", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, http.StatusBadGateway, "connection_failure"},
+		{"other", errors.New("boom"), http.StatusBadGateway, "error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, reason := classifyUpstreamError(tt.err)
+			if status != tt.wantStatus || reason != tt.wantReason {
+				t.Fatalf("classify = %d %s, want %d %s", status, reason, tt.wantStatus, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestProxyUnreachableUpstream(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	handler := newHTTPHandler(NewUltraMultiplexer(), nil)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy?target="+url.QueryEscape(closed.URL), nil))
+	if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "connection failure") {
+		t.Fatalf("status = %d, body %s; want 502 connection failure", rec.Code, rec.Body)
+	}
+}
+
+func TestProxyUserAgentAndVia(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s", r.UserAgent(), r.Header.Get("Via"))
+	}))
+	defer upstream.Close()
+
+	config := DefaultConfig()
+	config.ProxyUserAgent = "test-agent/1"
+	config.ProxyVia = "mux"
+	handler := newHTTPHandler(NewUltraMultiplexer(WithConfig(config)), nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/proxy?target="+url.QueryEscape(upstream.URL), nil)
+	req.Header.Set("User-Agent", "curl/8")
+	req.Header.Set("Via", "1.0 edge")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if want := "test-agent/1|1.0 edge, 1.1 mux"; rec.Body.String() != want {
+		t.Fatalf("upstream saw %q, want %q", rec.Body, want)
+	}
+}
+
+func TestProxyForwardsRange(t *testing.T) {
+	modified := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data.txt", modified, strings.NewReader("0123456789"))
+	}))
+	defer upstream.Close()
+	handler := newHTTPHandler(NewUltraMultiplexer(), nil)
+
+	tests := []struct {
+		name      string
+		ifRange   string
+		want      int
+		wantBody  string
+		wantRange string
+	}{
+		{"partial content", "", http.StatusPartialContent, "2345", "bytes 2-5/10"},
+		{"if-range matches", modified.Format(http.TimeFormat), http.StatusPartialContent, "2345", "bytes 2-5/10"},
+		{"if-range stale", modified.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK, "0123456789", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/proxy?target="+url.QueryEscape(upstream.URL), nil)
+			req.Header.Set("Range", "bytes=2-5")
+			if tt.ifRange != "" {
+				req.Header.Set("If-Range", tt.ifRange)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want || rec.Body.String() != tt.wantBody {
+				t.Fatalf("got %d %q, want %d %q", rec.Code, rec.Body, tt.want, tt.wantBody)
+			}
+			if got := rec.Header().Get("Content-Range"); got != tt.wantRange {
+				t.Fatalf("Content-Range = %q, want %q", got, tt.wantRange)
+			}
+		})
+	}
+}
+
+func TestProxyForwardsTrailers(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Trailer", "X-Upstream-Sum")
+		io.WriteString(w, "ok")
+		w.Header().Set("X-Upstream-Sum", r.Trailer.Get("X-Checksum"))
+	}))
+	defer upstream.Close()
+
+	config := DefaultConfig()
+	config.ProxyAllowedMethods = []string{http.MethodPost}
+	mux := httptest.NewServer(newHTTPHandler(NewUltraMultiplexer(WithConfig(config)), nil))
+	defer mux.Close()
+
+	req, err := http.NewRequest(http.MethodPost, mux.URL+"/proxy?target="+url.QueryEscape(upstream.URL), io.NopCloser(strings.NewReader("data")))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Trailer = http.Header{"X-Checksum": {"abc"}}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	if string(body) != "ok" || resp.Trailer.Get("X-Upstream-Sum") != "abc" {
+		t.Fatalf("body %q, trailer %q; want ok and abc", body, resp.Trailer.Get("X-Upstream-Sum"))
+	}
+}
+
+// readTracker отмечает, что клиентский транспорт начал отправлять тело
+type readTracker struct {
+	io.Reader
+	read *atomic.Bool
+}
+
+func (r readTracker) Read(p []byte) (int, error) {
+	r.read.Store(true)
+	return r.Reader.Read(p)
+}
+
+func TestProxyExpectContinue(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("reject") != "" {
+			http.Error(w, "too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s|%s", r.Header.Get("Expect"), body)
+	}))
+	defer upstream.Close()
+
+	config := DefaultConfig()
+	config.ProxyAllowedMethods = []string{http.MethodPut}
+	um := NewUltraMultiplexer(WithConfig(config))
+	mux := httptest.NewServer(newHTTPHandler(um, nil))
+	defer mux.Close()
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+
+	put := func(target string, bodySent *atomic.Bool) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPut, mux.URL+"/proxy?target="+url.QueryEscape(target), readTracker{strings.NewReader("data"), bodySent})
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req.ContentLength = 4
+		req.Header.Set("Expect", "100-continue")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("PUT: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	var bodySent atomic.Bool
+	if code, body := put(upstream.URL, &bodySent); code != http.StatusOK || body != "100-continue|data" {
+		t.Fatalf("got %d %q, want 200 \"100-continue|data\"", code, body)
+	}
+
+	// Upstream отказал сразу - клиент так и не получил 100 Continue
+	bodySent.Store(false)
+	if code, _ := put(upstream.URL+"?reject=1", &bodySent); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", code)
+	}
+	if bodySent.Load() {
+		t.Fatal("client sent the body of a rejected request")
+	}
+	counters, _ := um.metrics.Snapshot()["counters"].(map[string]int64)
+	if counters["proxy_expect_continue_total"] != 2 {
+		t.Fatalf("proxy_expect_continue_total = %d, want 2", counters["proxy_expect_continue_total"])
+	}
+}
+
+func TestProxyTargetTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+			io.WriteString(w, "slow")
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+	host := upstream.Listener.Addr().String()
+
+	tests := []struct {
+		name          string
+		clientTimeout time.Duration
+		targetTimeout time.Duration
+		want          int
+	}{
+		{"target shorter than client", 10 * time.Second, 50 * time.Millisecond, http.StatusGatewayTimeout},
+		{"target longer than client", 50 * time.Millisecond, 5 * time.Second, http.StatusOK},
+		{"client timeout without target", 50 * time.Millisecond, 0, http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.ProxyTargets = []ProxyTarget{{Host: host, Timeout: tt.targetTimeout}}
+			um := NewUltraMultiplexer(WithConfig(config), WithHTTPClient(&http.Client{Timeout: tt.clientTimeout}))
+			handler := newHTTPHandler(um, nil)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy?target="+url.QueryEscape(upstream.URL), nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestProxyContentTypeAllowlist(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		io.WriteString(w, "body")
+	}))
+	defer upstream.Close()
+
+	config := DefaultConfig()
+	config.ProxyAllowedContentTypes = []string{"application/json", "text/*"}
+	config.ProxyTargets = []ProxyTarget{{
+		Host:                upstream.Listener.Addr().String(),
+		PathPrefix:          "/images",
+		AllowedContentTypes: []string{"image/png"},
+	}}
+	handler := newHTTPHandler(NewUltraMultiplexer(WithConfig(config)), nil)
+
+	tests := []struct {
+		path, contentType string
+		want              int
+	}{
+		{"/", "application/json; charset=utf-8", http.StatusOK},
+		{"/", "text/plain", http.StatusOK},
+		{"/", "application/octet-stream", http.StatusBadGateway},
+		{"/", "not a media type", http.StatusBadGateway},
+		{"/images/a", "image/png", http.StatusOK},
+		{"/images/a", "text/plain", http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.contentType, func(t *testing.T) {
+			target := upstream.URL + tt.path + "?type=" + url.QueryEscape(tt.contentType)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy?target="+url.QueryEscape(target), nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyHostHeaderMode(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host)
+	}))
+	defer upstream.Close()
+	host := upstream.Listener.Addr().String()
+
+	config := DefaultConfig()
+	config.ProxyTargets = []ProxyTarget{
+		{Host: host, PathPrefix: "/preserve", HostMode: HostPreserve},
+		{Host: host, PathPrefix: "/fixed", HostMode: HostFixed, HostHeader: "api.internal"},
+	}
+	handler := newHTTPHandler(NewUltraMultiplexer(WithConfig(config)), nil)
+
+	tests := []struct {
+		path, want string
+	}{
+		{"/default", host},
+		{"/preserve", "mux.example"},
+		{"/fixed", "api.internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/proxy?target="+url.QueryEscape(upstream.URL+tt.path), nil)
+			req.Host = "mux.example"
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Body.String() != tt.want {
+				t.Fatalf("upstream Host = %q, want %q", rec.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateProxyTargetHostMode(t *testing.T) {
+	for _, target := range []ProxyTarget{
+		{Host: "a.example", HostMode: HostFixed},
+		{Host: "a.example", HostMode: "upstream"},
+	} {
+		config := DefaultConfig()
+		config.ProxyTargets = []ProxyTarget{target}
+		if err := NewUltraMultiplexer(WithConfig(config)).validateProxyTargets(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("host mode %q: error = %v, want ErrInvalidConfig", target.HostMode, err)
+		}
+	}
+}
+
+func TestProxyMaxConcurrent(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))
+	defer upstream.Close()
+
+	config := DefaultConfig()
+	config.ProxyMaxConcurrent = 1
+	handler := newHTTPHandler(NewUltraMultiplexer(WithConfig(config)), nil)
+	target := "/proxy?target=" + url.QueryEscape(upstream.URL)
+
+	first := make(chan int, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		first <- rec.Code
+	}()
+	<-entered
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("second request: status %d, Retry-After %q; want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	close(release)
+	if code := <-first; code != http.StatusOK {
+		t.Fatalf("first request status = %d, want 200", code)
+	}
+}
+
+func TestProxyBuffersSmallChunkedResponses(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		// Flush до конца тела - ответ уходит chunked без Content-Length
+		io.WriteString(w, "x")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, strings.Repeat("x", size-1))
+	}))
+	defer upstream.Close()
+
+	config := DefaultConfig()
+	config.ProxyBufferThreshold = 1024
+	handler := newHTTPHandler(NewUltraMultiplexer(WithConfig(config)), nil)
+
+	tests := []struct {
+		name        string
+		contentType string
+		size        int
+		wantLength  string
+	}{
+		{"small", "application/json", 100, "100"},
+		{"over threshold", "application/json", 4096, ""},
+		{"streaming type", "text/event-stream", 100, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fmt.Sprintf("%s/?type=%s&size=%d", upstream.URL, url.QueryEscape(tt.contentType), tt.size)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy?target="+url.QueryEscape(target), nil))
+			if rec.Code != http.StatusOK || rec.Body.Len() != tt.size {
+				t.Fatalf("status %d, %d bytes; want 200, %d bytes", rec.Code, rec.Body.Len(), tt.size)
+			}
+			if got := rec.Header().Get("Content-Length"); got != tt.wantLength {
+				t.Fatalf("Content-Length = %q, want %q", got, tt.wantLength)
+			}
+		})
+	}
+}
+
+func TestProxyInterruptedCopyLogged(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		io.WriteString(w, "partial")
+		w.(http.Flusher).Flush()
+		// Upstream сбрасывает соединение посреди тела
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer upstream.Close()
+
+	var out bytes.Buffer
+	um := NewUltraMultiplexer(WithLogger(log.New(&out, "", 0)))
+	handler := newHTTPHandler(um, nil)
+	req := httptest.NewRequest(http.MethodGet, "/proxy?target="+url.QueryEscape(upstream.URL), nil)
+	req = req.WithContext(withRequestID(req.Context(), "req-176"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	// Статус уже ушел - меняться он не должен
+	if rec.Code != http.StatusOK || rec.Body.String() != "partial" {
+		t.Fatalf("proxy returned %d %q", rec.Code, rec.Body)
+	}
+	if logged := out.String(); !strings.Contains(logged, "interrupted after 7 bytes (upstream, request_id=req-176)") {
+		t.Errorf("interrupted copy not logged:\n%s", logged)
+	}
+	counters, _ := um.metrics.Snapshot()["counters"].(map[string]int64)
+	if counters["proxy_response_interrupted_total"] != 1 {
+		t.Fatalf("proxy_response_interrupted_total not counted: %v", counters)
+	}
+}
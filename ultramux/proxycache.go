@@ -0,0 +1,267 @@
+package ultramux
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProxyCacheConfig - кэш GET ответов /proxy с валидаторами ETag и
+// Last-Modified. Устаревшие записи перепроверяются условным запросом,
+// и на 304 от upstream тело отдается из кэша
+type ProxyCacheConfig struct {
+	// MaxEntries - число кэшируемых URL. 0 - кэш выключен
+	MaxEntries int
+	// MaxBodyBytes - ответы больше не кэшируются; 0 - 1 MiB
+	MaxBodyBytes int64
+	// TTL - свежесть записи, если upstream не прислал Cache-Control: max-age
+	TTL time.Duration
+}
+
+type proxyCacheEntry struct {
+	header  http.Header
+	body    []byte
+	status  int
+	expires time.Time
+	stored  time.Time
+}
+
+func (e *proxyCacheEntry) etag() string {
+	return e.header.Get("ETag")
+}
+
+type proxyCache struct {
+	cfg   ProxyCacheConfig
+	clock Clock
+
+	mu      sync.Mutex
+	entries map[string]*proxyCacheEntry
+}
+
+func newProxyCache(cfg ProxyCacheConfig, clock Clock) *proxyCache {
+	if cfg.MaxEntries <= 0 {
+		return nil
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = 1 << 20
+	}
+	return &proxyCache{cfg: cfg, clock: clock, entries: make(map[string]*proxyCacheEntry)}
+}
+
+// proxyCacheKey - URL upstream'а вместе с фактическим Host: при
+// HostPreserve виртуальные хосты за одним target отдают разные ответы
+func proxyCacheKey(outReq *http.Request) string {
+	host := outReq.Host
+	if host == "" {
+		host = outReq.URL.Host
+	}
+	return host + " " + outReq.URL.String()
+}
+
+// cacheableRequest: кэшируем только простые GET без Range и без
+// Cache-Control: no-store со стороны клиента
+func (c *proxyCache) cacheableRequest(r *http.Request) bool {
+	if c == nil || r.Method != http.MethodGet || r.Header.Get("Range") != "" {
+		return false
+	}
+	return !hasCacheDirective(r.Header, "no-store")
+}
+
+// lookup возвращает запись и признак ее свежести
+func (c *proxyCache) lookup(key string) (*proxyCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return entry, c.clock.Now().Before(entry.expires)
+}
+
+// freshness - срок из Cache-Control upstream'а; no-store и private
+// запрещают хранение. Ответы с Set-Cookie не храним: кэш общий, и cookie
+// одного клиента ушла бы всем остальным
+func (c *proxyCache) freshness(h http.Header) (time.Duration, bool) {
+	if hasCacheDirective(h, "no-store") || hasCacheDirective(h, "private") || h.Get("Vary") != "" || len(h.Values("Set-Cookie")) > 0 {
+		return 0, false
+	}
+	if h.Get("ETag") == "" && h.Get("Last-Modified") == "" {
+		// Без валидаторов перепроверить запись нельзя
+		return 0, false
+	}
+	if hasCacheDirective(h, "no-cache") {
+		return 0, true
+	}
+	for _, directive := range cacheDirectives(h) {
+		if value, ok := strings.CutPrefix(directive, "max-age="); ok {
+			if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+				return time.Duration(seconds) * time.Second, true
+			}
+		}
+	}
+	return c.cfg.TTL, true
+}
+
+func (c *proxyCache) store(key string, status int, header http.Header, body []byte) {
+	ttl, ok := c.freshness(header)
+	if !ok {
+		return
+	}
+	now := c.clock.Now()
+	entry := &proxyCacheEntry{
+		header:  header.Clone(),
+		body:    body,
+		status:  status,
+		stored:  now,
+		expires: now.Add(ttl),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.cfg.MaxEntries {
+		c.evictLocked()
+	}
+	c.entries[key] = entry
+}
+
+// refresh продлевает запись после 304 от upstream, обновляя заголовки
+// из ответа (RFC 9111, раздел 4.3.4)
+func (c *proxyCache) refresh(key string, entry *proxyCacheEntry, header http.Header) *proxyCacheEntry {
+	updated := &proxyCacheEntry{header: entry.header.Clone(), body: entry.body, status: entry.status}
+	for _, name := range []string{"Cache-Control", "Date", "ETag", "Expires", "Last-Modified"} {
+		if values := header.Values(name); len(values) > 0 {
+			updated.header[name] = values
+		}
+	}
+	ttl, ok := c.freshness(updated.header)
+	if !ok {
+		c.mu.Lock()
+		delete(c.entries, key)
+		c.mu.Unlock()
+		return updated
+	}
+	now := c.clock.Now()
+	updated.stored, updated.expires = now, now.Add(ttl)
+
+	c.mu.Lock()
+	c.entries[key] = updated
+	c.mu.Unlock()
+	return updated
+}
+
+// evictLocked удаляет запись, устаревшую раньше остальных
+func (c *proxyCache) evictLocked() {
+	var oldestKey string
+	var oldest time.Time
+	for key, entry := range c.entries {
+		if oldestKey == "" || entry.expires.Before(oldest) {
+			oldestKey, oldest = key, entry.expires
+		}
+	}
+	delete(c.entries, oldestKey)
+}
+
+// setValidators превращает запрос к upstream в условный для перепроверки
+func (e *proxyCacheEntry) setValidators(outReq *http.Request) {
+	if etag := e.etag(); etag != "" {
+		outReq.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := e.header.Get("Last-Modified"); lastModified != "" {
+		outReq.Header.Set("If-Modified-Since", lastModified)
+	}
+}
+
+// notModified проверяет условные заголовки клиента против записи.
+// If-None-Match приоритетнее If-Modified-Since (RFC 9110, раздел 13.2.2)
+func (e *proxyCacheEntry) notModified(r *http.Request) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := e.etag()
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || weakETag(candidate) == weakETag(etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(e.header.Get("Last-Modified"))
+	return err == nil && !lastModified.After(ims)
+}
+
+// weakETag - сравнение ETag без учета слабости, как требует If-None-Match
+func weakETag(tag string) string {
+	return strings.TrimPrefix(tag, "W/")
+}
+
+// serveCached отдает ответ из кэша: 304, если клиент уже имеет эту версию
+func (um *UltraMultiplexer) serveCached(w http.ResponseWriter, r *http.Request, entry *proxyCacheEntry, cacheStatus string) {
+	um.metrics.Inc("proxy_cache_" + strings.ToLower(cacheStatus) + "_total")
+	w.Header().Set("X-Cache", cacheStatus)
+	age := int(um.clock.Now().Sub(entry.stored) / time.Second)
+
+	if entry.notModified(r) {
+		for _, name := range []string{"Cache-Control", "Date", "ETag", "Expires", "Last-Modified", "Vary"} {
+			if values := entry.header.Values(name); len(values) > 0 {
+				w.Header()[name] = values
+			}
+		}
+		w.Header().Set("Age", strconv.Itoa(age))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	copyHeader(w.Header(), entry.header)
+	w.Header().Set("Age", strconv.Itoa(age))
+	w.Header().Set("Content-Length", strconv.Itoa(len(entry.body)))
+	w.WriteHeader(entry.status)
+	w.Write(entry.body)
+}
+
+func cacheDirectives(h http.Header) []string {
+	var directives []string
+	for _, value := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			directives = append(directives, strings.ToLower(strings.TrimSpace(directive)))
+		}
+	}
+	return directives
+}
+
+func hasCacheDirective(h http.Header, name string) bool {
+	for _, directive := range cacheDirectives(h) {
+		if directive == name {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheCapture копирует тело ответа для кэша, пока оно не больше limit
+type cacheCapture struct {
+	buf      []byte
+	limit    int64
+	overflow bool
+}
+
+func (c *cacheCapture) Write(p []byte) (int, error) {
+	if !c.overflow {
+		if int64(len(c.buf)+len(p)) > c.limit {
+			c.overflow = true
+			c.buf = nil
+		} else {
+			c.buf = append(c.buf, p...)
+		}
+	}
+	return len(p), nil
+}
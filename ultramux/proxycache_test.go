@@ -0,0 +1,120 @@
+package ultramux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newProxyCacheTestHandler - обработчик /proxy с кэшем на фейковых часах
+func newProxyCacheTestHandler(t *testing.T) (http.Handler, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	config := DefaultConfig()
+	config.ProxyCache = ProxyCacheConfig{MaxEntries: 16, TTL: time.Minute}
+	um := NewUltraMultiplexer(WithConfig(config), WithClock(clock))
+	return newHTTPHandler(um, nil), clock
+}
+
+func proxyGet(handler http.Handler, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/proxy?target="+url.QueryEscape(target), nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestProxyCacheRevalidates(t *testing.T) {
+	var hits, conditional atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("v1"))
+	}))
+	defer upstream.Close()
+	handler, clock := newProxyCacheTestHandler(t)
+
+	steps := []struct {
+		name      string
+		advance   time.Duration
+		header    http.Header
+		wantCode  int
+		wantCache string
+		wantHits  int64
+	}{
+		{"miss", 0, nil, http.StatusOK, "MISS", 1},
+		{"fresh hit", 30 * time.Second, nil, http.StatusOK, "HIT", 1},
+		{"client conditional on hit", 0, http.Header{"If-None-Match": {`W/"v1"`}}, http.StatusNotModified, "HIT", 1},
+		{"stale revalidated", 31 * time.Second, nil, http.StatusOK, "REVALIDATED", 2},
+		{"fresh after revalidation", 30 * time.Second, nil, http.StatusOK, "HIT", 2},
+		{"client no-cache revalidates", 0, http.Header{"Cache-Control": {"no-cache"}}, http.StatusOK, "REVALIDATED", 3},
+	}
+	for _, step := range steps {
+		clock.Advance(step.advance)
+		rec := proxyGet(handler, upstream.URL, step.header)
+		if rec.Code != step.wantCode || rec.Header().Get("X-Cache") != step.wantCache {
+			t.Fatalf("%s: status %d, X-Cache %q; want %d, %q", step.name, rec.Code, rec.Header().Get("X-Cache"), step.wantCode, step.wantCache)
+		}
+		if step.wantCode == http.StatusOK && rec.Body.String() != "v1" {
+			t.Fatalf("%s: body = %q, want v1", step.name, rec.Body)
+		}
+		if got := hits.Load(); got != step.wantHits {
+			t.Fatalf("%s: upstream hits = %d, want %d", step.name, got, step.wantHits)
+		}
+	}
+	if got := conditional.Load(); got != 2 {
+		t.Fatalf("conditional upstream requests = %d, want 2", got)
+	}
+}
+
+func TestProxyCacheSkipsUncacheableResponses(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+	}{
+		{"set-cookie", http.Header{"Set-Cookie": {"session=secret"}}},
+		{"vary", http.Header{"Vary": {"Accept-Encoding"}}},
+		{"private", http.Header{"Cache-Control": {"private, max-age=60"}}},
+		{"no-store", http.Header{"Cache-Control": {"no-store"}}},
+		{"no validators", http.Header{"ETag": nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int64
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits.Add(1)
+				w.Header().Set("ETag", `"v1"`)
+				for name, values := range tt.header {
+					if values == nil {
+						w.Header().Del(name)
+						continue
+					}
+					w.Header()[name] = values
+				}
+				w.Write([]byte("v1"))
+			}))
+			defer upstream.Close()
+			handler, _ := newProxyCacheTestHandler(t)
+
+			for i := 0; i < 2; i++ {
+				if rec := proxyGet(handler, upstream.URL, nil); rec.Code != http.StatusOK || rec.Header().Get("X-Cache") == "HIT" {
+					t.Fatalf("request %d: status %d, X-Cache %q", i, rec.Code, rec.Header().Get("X-Cache"))
+				}
+			}
+			if got := hits.Load(); got != 2 {
+				t.Fatalf("upstream hits = %d, want 2", got)
+			}
+		})
+	}
+}
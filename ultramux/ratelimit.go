@@ -0,0 +1,135 @@
+package ultramux
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket - классический token bucket: rate токенов в секунду, не больше burst
+type tokenBucket struct {
+	mu     sync.Mutex
+	clock  Clock
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64, clock Clock) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		clock:  clock,
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   clock.Now(),
+	}
+}
+
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RateLimit - скорость token bucket; PerSecond 0 - без ограничения
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// MethodRateLimitConfig - rate limiting gRPC по методам: дорогие RPC можно
+// ограничить сильнее дешевых
+type MethodRateLimitConfig struct {
+	// Default применяется к методам, которых нет в Methods
+	Default RateLimit
+	// Methods - лимиты по полному имени метода, например "/pb.UltraService/ProcessData"
+	Methods map[string]RateLimit
+	// PerClient - отдельный bucket на клиента (Identity.Subject, x-api-key
+	// или IP), иначе один общий на метод
+	PerClient bool
+}
+
+func (c MethodRateLimitConfig) enabled() bool {
+	if c.Default.PerSecond > 0 {
+		return true
+	}
+	for _, limit := range c.Methods {
+		if limit.PerSecond > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// maxRateLimitBuckets - при превышении удаляются простаивающие buckets
+const maxRateLimitBuckets = 10000
+
+type methodRateLimiter struct {
+	cfg   MethodRateLimitConfig
+	clock Clock
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newMethodRateLimiter(cfg MethodRateLimitConfig, clock Clock) *methodRateLimiter {
+	if !cfg.enabled() {
+		return nil
+	}
+	return &methodRateLimiter{cfg: cfg, clock: clock, buckets: make(map[string]*tokenBucket)}
+}
+
+func (l *methodRateLimiter) allow(method, client string) bool {
+	limit, ok := l.cfg.Methods[method]
+	if !ok {
+		limit = l.cfg.Default
+	}
+	if limit.PerSecond <= 0 {
+		return true
+	}
+
+	key := method
+	if l.cfg.PerClient {
+		key += " " + client
+	}
+
+	l.mu.Lock()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitBuckets {
+			l.pruneLocked()
+		}
+		bucket = newTokenBucket(limit.PerSecond, float64(limit.Burst), l.clock)
+		l.buckets[key] = bucket
+	}
+	l.mu.Unlock()
+
+	return bucket.allow()
+}
+
+// pruneLocked удаляет buckets, которые уже успели бы заполниться: их
+// клиенты давно не приходили, и новый bucket ничем не отличается
+func (l *methodRateLimiter) pruneLocked() {
+	now := l.clock.Now()
+	for key, b := range l.buckets {
+		b.mu.Lock()
+		idle := b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+		b.mu.Unlock()
+		if idle {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package ultramux
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMethodRateLimiter(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	limiter := newMethodRateLimiter(MethodRateLimitConfig{
+		Default: RateLimit{PerSecond: 1, Burst: 2},
+		Methods: map[string]RateLimit{
+			"/pkg.Svc/Free": {},
+		},
+		PerClient: true,
+	}, clock)
+
+	for i := 0; i < 2; i++ {
+		if !limiter.allow("/pkg.Svc/Get", "a") {
+			t.Fatalf("call %d within burst rejected", i)
+		}
+	}
+	if limiter.allow("/pkg.Svc/Get", "a") {
+		t.Fatal("call over burst allowed")
+	}
+	// Отдельные buckets: другой клиент и другой метод не затронуты
+	if !limiter.allow("/pkg.Svc/Get", "b") || !limiter.allow("/pkg.Svc/Put", "a") {
+		t.Fatal("independent bucket throttled")
+	}
+	// Метод без лимита не ограничивается
+	for i := 0; i < 10; i++ {
+		if !limiter.allow("/pkg.Svc/Free", "a") {
+			t.Fatal("unlimited method throttled")
+		}
+	}
+
+	clock.Advance(time.Second)
+	if !limiter.allow("/pkg.Svc/Get", "a") {
+		t.Fatal("token not refilled after a second")
+	}
+	if limiter.allow("/pkg.Svc/Get", "a") {
+		t.Fatal("refilled more than one token")
+	}
+}
+
+func TestMethodRateLimiterDisabled(t *testing.T) {
+	if l := newMethodRateLimiter(MethodRateLimitConfig{Methods: map[string]RateLimit{"/pkg.Svc/Get": {Burst: 5}}}, realClock{}); l != nil {
+		t.Fatal("limiter created without a positive rate")
+	}
+}
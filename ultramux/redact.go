@@ -0,0 +1,70 @@
+package ultramux
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const redactedValue = "[REDACTED]"
+
+// redacted сообщает, что значение ключа нельзя писать в логи
+// (Config.LogRedactKeys, без учета регистра)
+func (um *UltraMultiplexer) redacted(key string) bool {
+	for _, k := range um.config.LogRedactKeys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// loggedHeaders собирает Config.AccessLogHeaders для access-лога; values
+// возвращает значения заголовка или ключа метаданных
+func (um *UltraMultiplexer) loggedHeaders(values func(key string) []string) map[string]string {
+	if len(um.config.AccessLogHeaders) == 0 {
+		return nil
+	}
+	headers := make(map[string]string)
+	for _, key := range um.config.AccessLogHeaders {
+		v := values(key)
+		if len(v) == 0 {
+			continue
+		}
+		if um.redacted(key) {
+			headers[key] = redactedValue
+		} else {
+			headers[key] = strings.Join(v, ", ")
+		}
+	}
+	return headers
+}
+
+// incomingMetadata - поиск значений во входящих метаданных gRPC для loggedHeaders
+func incomingMetadata(ctx context.Context) func(key string) []string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return md.Get
+}
+
+// formatHeaders - заголовки одной строкой в стабильном порядке, с
+// замаскированными значениями чувствительных ключей
+func (um *UltraMultiplexer) formatHeaders(h http.Header) string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := strings.Join(h[key], ", ")
+		if um.redacted(key) {
+			value = redactedValue
+		}
+		parts = append(parts, key+": "+value)
+	}
+	return strings.Join(parts, "; ")
+}
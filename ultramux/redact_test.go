@@ -0,0 +1,49 @@
+package ultramux
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestAccessLogRedactsSensitiveHeaders(t *testing.T) {
+	config := DefaultConfig()
+	config.AccessLogHeaders = []string{"authorization", "X-Tenant", "X-Missing"}
+	um := NewUltraMultiplexer(WithConfig(config))
+	handler := um.accessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/echo", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Add("X-Tenant", "a")
+	req.Header.Add("X-Tenant", "b")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	headers := um.requestLog.snapshot()[0].Headers
+	if headers["authorization"] != redactedValue || headers["X-Tenant"] != "a, b" {
+		t.Fatalf("logged headers = %v", headers)
+	}
+	if _, ok := headers["X-Missing"]; ok {
+		t.Fatalf("absent header logged: %v", headers)
+	}
+
+	// Ключи gRPC метаданных маскируются так же
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer secret"))
+	if got := um.loggedHeaders(incomingMetadata(ctx)); got["authorization"] != redactedValue {
+		t.Fatalf("logged metadata = %v", got)
+	}
+}
+
+func TestFormatHeadersRedacts(t *testing.T) {
+	um := NewUltraMultiplexer()
+	got := um.formatHeaders(http.Header{
+		"Cookie":       {"session=1"},
+		"Content-Type": {"text/plain"},
+		"X-Api-Key":    {"k"},
+	})
+	if want := "Content-Type: text/plain; Cookie: [REDACTED]; X-Api-Key: [REDACTED]"; got != want {
+		t.Fatalf("formatHeaders = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,133 @@
+package ultramux
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// newRequestID - случайный идентификатор, если клиент не прислал свой
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestIDFromContext возвращает идентификатор текущего HTTP или gRPC запроса
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// httpRequestID берет X-Request-Id клиента или создает новый
+func httpRequestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); id != "" && len(id) <= 128 {
+		return id
+	}
+	return newRequestID()
+}
+
+// grpcRequestID берет x-request-id из метаданных или создает новый
+func grpcRequestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get("x-request-id"); len(ids) > 0 && ids[0] != "" && len(ids[0]) <= 128 {
+			return ids[0]
+		}
+	}
+	return newRequestID()
+}
+
+// contextStream подменяет контекст серверного стрима
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// requestLogEntry - запись о завершенном запросе в кольцевом буфере
+type requestLogEntry struct {
+	Time       time.Time `json:"timestamp"`
+	Protocol   string    `json:"protocol"`
+	Method     string    `json:"method,omitempty"`
+	Path       string    `json:"path"`
+	Status     string    `json:"status"`
+	DurationMs float64   `json:"duration_ms"`
+	RequestID  string    `json:"request_id"`
+	// Headers - Config.AccessLogHeaders после маскирования
+	Headers map[string]string `json:"headers,omitempty"`
+	// Aborted - обработчик оборвал соединение паникой (например, ответ
+	// /proxy превысил ProxyMaxResponseBytes); Status - уже отправленный код
+	Aborted bool `json:"aborted,omitempty"`
+}
+
+// requestRing хранит последние size запросов
+type requestRing struct {
+	mu      sync.Mutex
+	entries []requestLogEntry
+	next    int
+	full    bool
+}
+
+func newRequestRing(size int) *requestRing {
+	if size <= 0 {
+		return nil
+	}
+	return &requestRing{entries: make([]requestLogEntry, size)}
+}
+
+func (r *requestRing) add(entry requestLogEntry) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshot возвращает записи от новых к старым
+func (r *requestRing) snapshot() []requestLogEntry {
+	if r == nil {
+		return []requestLogEntry{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.next
+	if r.full {
+		n = len(r.entries)
+	}
+	out := make([]requestLogEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, r.entries[(r.next-i+len(r.entries))%len(r.entries)])
+	}
+	return out
+}
+
+func (h *HTTPHandler) recentRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	h.multiplexer.writeJSON(w, 0, map[string]interface{}{
+		"capacity": h.multiplexer.config.RequestLogSize,
+		"requests": h.multiplexer.requestLog.snapshot(),
+	})
+}
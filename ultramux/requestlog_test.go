@@ -0,0 +1,62 @@
+package ultramux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRequestRingKeepsNewest(t *testing.T) {
+	ring := newRequestRing(3)
+	for i := 1; i <= 5; i++ {
+		ring.add(requestLogEntry{Path: "/" + strconv.Itoa(i)})
+	}
+
+	entries := ring.snapshot()
+	want := []string{"/5", "/4", "/3"}
+	if len(entries) != len(want) {
+		t.Fatalf("snapshot has %d entries, want %d", len(entries), len(want))
+	}
+	for i, path := range want {
+		if entries[i].Path != path {
+			t.Fatalf("entry %d = %s, want %s", i, entries[i].Path, path)
+		}
+	}
+
+	if entries := newRequestRing(0).snapshot(); len(entries) != 0 {
+		t.Fatalf("disabled ring returned %d entries", len(entries))
+	}
+}
+
+func TestAccessLogRequestID(t *testing.T) {
+	um := NewUltraMultiplexer()
+	var seen string
+	handler := um.accessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/echo", nil)
+	req.Header.Set(requestIDHeader, "client-id")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if seen != "client-id" || rec.Header().Get(requestIDHeader) != "client-id" {
+		t.Fatalf("request ID in context %q, header %q; want client-id", seen, rec.Header().Get(requestIDHeader))
+	}
+
+	// Слишком длинный идентификатор клиента заменяется своим
+	req = httptest.NewRequest(http.MethodGet, "/echo", nil)
+	req.Header.Set(requestIDHeader, strings.Repeat("x", 200))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get(requestIDHeader); got == "" || len(got) > 128 {
+		t.Fatalf("generated request ID = %q", got)
+	}
+
+	entries := um.requestLog.snapshot()
+	if len(entries) != 2 || entries[1].RequestID != "client-id" || entries[1].Status != "418" {
+		t.Fatalf("request log = %+v", entries)
+	}
+}
@@ -0,0 +1,125 @@
+package ultramux
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// RetryBudgetConfig - параметры throttling'а ретраев по gRFC A6.
+// Каждая неудачная попытка тратит токен, каждая успешная возвращает
+// TokenRatio токена. Ретраи разрешены, пока токенов больше MaxTokens/2,
+// так что при массовых отказах доля ретраев ограничена долей успешных запросов.
+type RetryBudgetConfig struct {
+	MaxTokens  float64
+	TokenRatio float64
+}
+
+type retryBudget struct {
+	mu         sync.Mutex
+	maxTokens  float64
+	tokenRatio float64
+	tokens     float64
+}
+
+func newRetryBudget(cfg RetryBudgetConfig) *retryBudget {
+	if cfg.MaxTokens <= 0 {
+		cfg.MaxTokens = 10
+	}
+	if cfg.TokenRatio <= 0 {
+		cfg.TokenRatio = 0.1
+	}
+	return &retryBudget{
+		maxTokens:  cfg.MaxTokens,
+		tokenRatio: cfg.TokenRatio,
+		tokens:     cfg.MaxTokens,
+	}
+}
+
+func (b *retryBudget) onSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.maxTokens, b.tokens+b.tokenRatio)
+}
+
+func (b *retryBudget) onFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Max(0, b.tokens-1)
+}
+
+func (b *retryBudget) allowRetry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens > b.maxTokens/2
+}
+
+func (b *retryBudget) available() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens
+}
+
+// retryBackoff - экспоненциальная задержка перед повтором: 100ms, 200ms, ... до 2s
+func retryBackoff(retry int) time.Duration {
+	backoff := 100 * time.Millisecond << uint(retry)
+	if backoff <= 0 || backoff > 2*time.Second {
+		backoff = 2 * time.Second
+	}
+	return backoff
+}
+
+// JitterStrategy - способ рандомизации задержек между попытками, чтобы
+// одновременно стартовавшие инстансы не ретраили синхронно
+type JitterStrategy string
+
+const (
+	JitterNone  JitterStrategy = "none"  // фиксированная задержка
+	JitterFull  JitterStrategy = "full"  // случайная в [0, d)
+	JitterEqual JitterStrategy = "equal" // d/2 + случайная в [0, d/2)
+)
+
+// withJitter применяет стратегию Config.RetryJitter к задержке d
+func (um *UltraMultiplexer) withJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	switch um.config.RetryJitter {
+	case JitterFull:
+		return rand.N(d)
+	case JitterEqual:
+		half := d / 2
+		return half + rand.N(d-half)
+	default:
+		return d
+	}
+}
+
+// withRetries вызывает attempt, пока он сообщает о неудаче, но не больше
+// maxRetries повторов и только пока это позволяет общий бюджет ретраев
+func (um *UltraMultiplexer) withRetries(ctx context.Context, maxRetries int, attempt func() (failed bool)) {
+	for retry := 0; ; retry++ {
+		if !attempt() {
+			um.retryBudget.onSuccess()
+			return
+		}
+		um.retryBudget.onFailure()
+
+		if retry >= maxRetries {
+			return
+		}
+		if !um.retryBudget.allowRetry() {
+			um.metrics.Inc("retries_throttled_total")
+			return
+		}
+
+		select {
+		case <-um.clock.After(um.withJitter(retryBackoff(retry))):
+		case <-ctx.Done():
+			return
+		}
+		um.metrics.Inc("retries_total")
+	}
+}
@@ -0,0 +1,48 @@
+package ultramux
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRetryBudgetThrottlesRetries(t *testing.T) {
+	config := DefaultConfig()
+	config.RetryBudget = RetryBudgetConfig{MaxTokens: 4, TokenRatio: 1}
+	um := NewUltraMultiplexer(WithConfig(config))
+	um.clock = &fakeClock{now: time.Unix(0, 0)}
+
+	attempts := 0
+	um.withRetries(context.Background(), 10, func() bool {
+		attempts++
+		return true
+	})
+	// 4 -> 3 токена: ретрай разрешен; 3 -> 2: бюджет исчерпан (нужно больше половины)
+	if attempts != 2 {
+		t.Fatalf("attempts = %d, want 2", attempts)
+	}
+	counters, _ := um.metrics.Snapshot()["counters"].(map[string]int64)
+	if counters["retries_throttled_total"] != 1 {
+		t.Fatalf("retries_throttled_total = %d, want 1", counters["retries_throttled_total"])
+	}
+
+	// Успешный запрос возвращает токен, и ретраи снова разрешены
+	um.withRetries(context.Background(), 0, func() bool { return false })
+	if !um.retryBudget.allowRetry() {
+		t.Fatalf("retry not allowed with %.1f tokens", um.retryBudget.available())
+	}
+}
+
+func TestRetryBudgetCapsTokens(t *testing.T) {
+	b := newRetryBudget(RetryBudgetConfig{MaxTokens: 2, TokenRatio: 1})
+	b.onSuccess()
+	if got := b.available(); got != 2 {
+		t.Fatalf("tokens = %v, want capped at 2", got)
+	}
+	b.onFailure()
+	b.onFailure()
+	b.onFailure()
+	if got := b.available(); got != 0 {
+		t.Fatalf("tokens = %v, want 0", got)
+	}
+}
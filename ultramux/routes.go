@@ -0,0 +1,217 @@
+package ultramux
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Route описывает HTTP эндпоинт мультиплексора
+type Route struct {
+	Path string
+	// Methods - допустимые HTTP методы: на остальные отвечаем 405 с Allow.
+	// GET разрешает и HEAD; пустой список или "*" - любой метод
+	Methods     []string
+	Description string
+	Params      []RouteParam
+	Handler     http.HandlerFunc
+	// WriteTimeout переопределяет WriteTimeout сервера (30s) для маршрута:
+	// 0 - оставить серверный, <0 - без дедлайна (долгие стримы)
+	WriteTimeout time.Duration
+}
+
+type routeInfo struct {
+	Path        string   `json:"path"`
+	Methods     []string `json:"methods"`
+	Description string   `json:"description,omitempty"`
+}
+
+type grpcServiceIndex struct {
+	Service string   `json:"service"`
+	Methods []string `json:"methods"`
+}
+
+func newHTTPHandler(um *UltraMultiplexer, custom []Route) *HTTPHandler {
+	h := &HTTPHandler{
+		multiplexer: um,
+		routes:      make(map[string]Route),
+	}
+
+	h.handle(Route{Path: "/health", Methods: []string{http.MethodGet}, Description: "Liveness check", Handler: h.healthCheck})
+	h.handle(Route{Path: "/readyz", Methods: []string{http.MethodGet}, Description: "Readiness including upstream dependencies", Handler: h.readinessCheck})
+	h.handle(Route{Path: "/metrics", Methods: []string{http.MethodGet}, Description: "Internal metrics as JSON", Handler: h.metricsHandler})
+	h.handle(Route{Path: "/stats", Methods: []string{http.MethodGet}, Description: "Connections and bytes in/out per protocol", Handler: h.statsHandler})
+	h.handle(Route{Path: "/favicon.ico", Methods: []string{http.MethodGet, http.MethodHead}, Description: "Configured favicon or an empty 404", Handler: h.faviconHandler})
+	h.handle(Route{Path: "/openapi.json", Methods: []string{http.MethodGet}, Description: "OpenAPI description of the HTTP endpoints", Handler: h.openAPIHandler})
+	h.handle(Route{
+		Path:        "/proxy",
+		Methods:     []string{"*"},
+		Description: "Forward the request to the URL in the target parameter (GET and HEAD unless more methods are allowed)",
+		Params: []RouteParam{
+			{Name: "target", In: "query", Description: "Absolute http(s) URL of the upstream", Required: um.config.ProxyDefaultTarget == ""},
+		},
+		Handler:      h.proxyRequest,
+		WriteTimeout: um.config.ProxyWriteTimeout,
+	})
+	h.handle(Route{
+		Path:        "/grpc-call",
+		Methods:     bridgeMethods,
+		Description: "Call UltraService.SayHello via the internal gRPC client (same as /grpc-call/SayHello)",
+		Params:      sayHelloParams,
+		Handler:     h.callGRPC(bridgeSayHello),
+	})
+	h.handle(Route{
+		Path:        "/grpc-call/SayHello",
+		Methods:     bridgeMethods,
+		Description: "Call UltraService.SayHello via the internal gRPC client",
+		Params:      sayHelloParams,
+		Handler:     h.callGRPC(bridgeSayHello),
+	})
+	h.handle(Route{
+		Path:        "/grpc-call/ProcessData",
+		Methods:     bridgeMethods,
+		Description: "Call UltraService.ProcessData via the internal gRPC client",
+		Params: append([]RouteParam{
+			{Name: "data", In: "query", Description: "ProcessData input, alternatively JSON body {\"data\": ...} on POST"},
+		}, bridgeCallParams...),
+		Handler: h.callGRPC(bridgeProcessData),
+	})
+	h.handle(Route{
+		Path:        "/grpc-stream",
+		Methods:     bridgeMethods,
+		Description: "Call the server-streaming ProcessDataStream, replies are written as NDJSON",
+		Params: []RouteParam{
+			{Name: "data", In: "query", Description: "ProcessDataStream input, one reply per line; alternatively JSON body {\"data\": ...}"},
+			{Name: grpcTimeoutHeader, In: "header", Description: "Shorter deadline for the whole stream, e.g. 30s"},
+		},
+		Handler: h.streamGRPC,
+		// Общий WriteTimeout сервера (30s) оборвал бы стрим, которому
+		// BridgeMaxTimeout разрешает больше
+		WriteTimeout: um.bridgeMaxTimeout() + bridgeStreamWriteGrace,
+	})
+
+	h.handle(Route{
+		Path:        "/gateway",
+		Methods:     []string{http.MethodPost},
+		Description: "Call any unary gRPC method with a JSON body, transcoded via its protobuf descriptors",
+		Params: []RouteParam{
+			{Name: "method", In: "query", Description: "Method name of UltraService (SayHello) or full /pkg.Service/Method of a service from GatewayServices", Required: true},
+			{Name: grpcTimeoutHeader, In: "header", Description: "Shorter call deadline, e.g. 2s"},
+		},
+		Handler: h.gatewayCall,
+	})
+	h.handle(Route{
+		Path:        "/admin/reconnect-grpc",
+		Methods:     []string{http.MethodPost},
+		Description: "Re-establish the internal gRPC client connection (admin token required)",
+		Handler:     h.adminOnly(h.reconnectGRPCHandler),
+	})
+	h.handle(Route{
+		Path:        "/admin/requests",
+		Methods:     []string{http.MethodGet},
+		Description: "Most recent HTTP and gRPC requests, newest first (admin token required)",
+		Handler:     h.adminOnly(h.recentRequestsHandler),
+	})
+	h.handle(Route{
+		Path:        "/admin/inflight",
+		Methods:     []string{http.MethodGet, http.MethodDelete},
+		Description: "List in-flight HTTP and gRPC requests; DELETE ?id= cancels one (admin token required)",
+		Params: []RouteParam{
+			{Name: "id", In: "query", Description: "Request ID to cancel (DELETE)"},
+		},
+		Handler: h.adminOnly(h.inflightHandler),
+	})
+	h.handle(Route{
+		Path:        adminFlagsPath,
+		Methods:     []string{http.MethodGet, http.MethodPost},
+		Description: "Read or toggle endpoints at runtime, e.g. {\"/proxy\": false} (admin token required)",
+		Handler:     h.adminOnly(h.flagsHandler),
+	})
+
+	for _, route := range custom {
+		h.handle(route)
+	}
+	return h
+}
+
+func (h *HTTPHandler) handle(route Route) {
+	if _, exists := h.routes[route.Path]; !exists {
+		h.paths = append(h.paths, route.Path)
+	}
+	route.Handler = h.requireMethods(route.Methods, route.Handler)
+	h.routes[route.Path] = route
+}
+
+// requireMethods отвечает 405 на методы не из списка Route.Methods
+func (h *HTTPHandler) requireMethods(methods []string, next http.HandlerFunc) http.HandlerFunc {
+	if len(methods) == 0 || methodAllowed("*", methods) {
+		return next
+	}
+	allowed := methods
+	if methodAllowed(http.MethodGet, methods) && !methodAllowed(http.MethodHead, methods) {
+		allowed = append(append([]string(nil), methods...), http.MethodHead)
+	}
+	allow := strings.Join(allowed, ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !methodAllowed(r.Method, allowed) {
+			w.Header().Set("Allow", allow)
+			h.multiplexer.writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// applyWriteTimeout переставляет дедлайн записи соединения под маршрут
+func (h *HTTPHandler) applyWriteTimeout(w http.ResponseWriter, route Route) {
+	if route.WriteTimeout == 0 {
+		return
+	}
+
+	var deadline time.Time
+	if route.WriteTimeout > 0 {
+		deadline = time.Now().Add(route.WriteTimeout)
+	}
+	if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil {
+		h.multiplexer.logger.Printf("⚠️ Cannot change write deadline for %s: %v", route.Path, err)
+	}
+}
+
+// RegisterRoute добавляет собственный HTTP эндпоинт. Маршрут с путем
+// встроенного эндпоинта заменяет его. Должен вызываться до Initialize.
+func (um *UltraMultiplexer) RegisterRoute(route Route) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.httpRoutes = append(um.httpRoutes, route)
+}
+
+func (h *HTTPHandler) routeIndex() []routeInfo {
+	index := make([]routeInfo, 0, len(h.paths))
+	for _, path := range h.paths {
+		route := h.routes[path]
+		index = append(index, routeInfo{
+			Path:        route.Path,
+			Methods:     route.Methods,
+			Description: route.Description,
+		})
+	}
+	return index
+}
+
+// grpcIndex перечисляет зарегистрированные gRPC сервисы и их методы
+func (um *UltraMultiplexer) grpcIndex() []grpcServiceIndex {
+	info := um.grpcServer.GetServiceInfo()
+
+	index := make([]grpcServiceIndex, 0, len(info))
+	for name, service := range info {
+		methods := make([]string, 0, len(service.Methods))
+		for _, method := range service.Methods {
+			methods = append(methods, method.Name)
+		}
+		sort.Strings(methods)
+		index = append(index, grpcServiceIndex{Service: name, Methods: methods})
+	}
+	sort.Slice(index, func(i, j int) bool { return index[i].Service < index[j].Service })
+	return index
+}
@@ -0,0 +1,206 @@
+package ultramux
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestRouteMethodsEnforced(t *testing.T) {
+	um := NewUltraMultiplexer()
+	handler := newHTTPHandler(um, []Route{{
+		Path:    "/custom",
+		Handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) },
+	}})
+
+	tests := []struct {
+		method, path string
+		want         int
+		allow        string
+	}{
+		{http.MethodGet, "/health", http.StatusOK, ""},
+		{http.MethodHead, "/health", http.StatusOK, ""},
+		{http.MethodDelete, "/health", http.StatusMethodNotAllowed, "GET, HEAD"},
+		{http.MethodPost, "/metrics", http.StatusMethodNotAllowed, "GET, HEAD"},
+		{http.MethodGet, "/gateway", http.StatusMethodNotAllowed, "POST"},
+		{http.MethodPut, "/grpc-call", http.StatusMethodNotAllowed, "GET, POST, HEAD"},
+		// Без Methods маршрут принимает любой метод
+		{http.MethodPatch, "/custom", http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.allow {
+				t.Fatalf("Allow = %q, want %q", got, tt.allow)
+			}
+		})
+	}
+}
+
+func TestDefaultHandlerListsRoutes(t *testing.T) {
+	um := NewUltraMultiplexer()
+	um.grpcServer = grpc.NewServer()
+	handler := newHTTPHandler(um, []Route{{
+		Path:        "/custom",
+		Methods:     []string{http.MethodGet},
+		Description: "Custom endpoint",
+		Handler:     func(w http.ResponseWriter, r *http.Request) {},
+	}})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var body struct {
+		Routes []routeInfo `json:"routes"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	found := map[string]routeInfo{}
+	for _, route := range body.Routes {
+		found[route.Path] = route
+	}
+	if route, ok := found["/custom"]; !ok || route.Description != "Custom endpoint" {
+		t.Fatalf("custom route = %+v, present %v", route, ok)
+	}
+	for _, path := range []string{"/health", "/proxy", "/grpc-call"} {
+		if _, ok := found[path]; !ok {
+			t.Errorf("built-in route %s missing from the index", path)
+		}
+	}
+}
+
+func TestOpenAPIDocumentFromRoutes(t *testing.T) {
+	handler := newHTTPHandler(NewUltraMultiplexer(), []Route{{
+		Path:        "/custom",
+		Methods:     []string{http.MethodGet, http.MethodPost},
+		Description: "Custom endpoint",
+		Params:      []RouteParam{{Name: "id", In: "query", Required: true}},
+		Handler:     func(w http.ResponseWriter, r *http.Request) {},
+	}})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			Summary    string `json:"summary"`
+			Parameters []struct {
+				Name     string `json:"name"`
+				In       string `json:"in"`
+				Required bool   `json:"required"`
+			} `json:"parameters"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if doc.OpenAPI == "" {
+		t.Fatal("openapi version missing")
+	}
+
+	custom := doc.Paths["/custom"]
+	if len(custom) != 2 {
+		t.Fatalf("/custom operations = %v, want get and post", custom)
+	}
+	get := custom["get"]
+	if get.Summary != "Custom endpoint" || len(get.Parameters) != 1 || get.Parameters[0].Name != "id" || !get.Parameters[0].Required {
+		t.Fatalf("GET /custom = %+v", get)
+	}
+	// "*" разворачивается во все методы
+	if _, ok := doc.Paths["/proxy"]["delete"]; !ok {
+		t.Fatalf("/proxy operations = %v, want every method", doc.Paths["/proxy"])
+	}
+}
+
+func TestFavicon(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	tests := []struct {
+		name     string
+		icon     []byte
+		want     int
+		wantType string
+	}{
+		{"not configured", nil, http.StatusNotFound, ""},
+		{"png", png, http.StatusOK, "image/png"},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), http.StatusOK, "image/svg+xml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Favicon = tt.icon
+			handler := newHTTPHandler(NewUltraMultiplexer(WithConfig(config)), nil)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+			if rec.Code != tt.want || rec.Header().Get("Content-Type") != tt.wantType {
+				t.Fatalf("status %d, Content-Type %q; want %d, %q", rec.Code, rec.Header().Get("Content-Type"), tt.want, tt.wantType)
+			}
+			if rec.Body.Len() != len(tt.icon) {
+				t.Fatalf("body has %d bytes, want %d", rec.Body.Len(), len(tt.icon))
+			}
+		})
+	}
+}
+
+// deadlineRecorder запоминает дедлайны, выставленные через ResponseController
+type deadlineRecorder struct {
+	*httptest.ResponseRecorder
+	deadlines []time.Time
+}
+
+func (r *deadlineRecorder) SetWriteDeadline(deadline time.Time) error {
+	r.deadlines = append(r.deadlines, deadline)
+	return nil
+}
+
+func TestRouteWriteTimeout(t *testing.T) {
+	h := newHTTPHandler(NewUltraMultiplexer(), nil)
+
+	tests := []struct {
+		name         string
+		writeTimeout time.Duration
+		wantSet      bool
+		wantZero     bool
+	}{
+		{"server default", 0, false, false},
+		{"extended", 10 * time.Minute, true, false},
+		{"disabled", -1, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+			h.applyWriteTimeout(rec, Route{Path: "/download", WriteTimeout: tt.writeTimeout})
+			if got := len(rec.deadlines) == 1; got != tt.wantSet {
+				t.Fatalf("deadlines set: %v, want set=%v", rec.deadlines, tt.wantSet)
+			}
+			if !tt.wantSet {
+				return
+			}
+			deadline := rec.deadlines[0]
+			if deadline.IsZero() != tt.wantZero {
+				t.Fatalf("deadline = %v, want zero=%v", deadline, tt.wantZero)
+			}
+			if !tt.wantZero && time.Until(deadline) < tt.writeTimeout-time.Minute {
+				t.Fatalf("deadline = %v, want about now+%v", deadline, tt.writeTimeout)
+			}
+		})
+	}
+}
+
+func TestProxyRouteOverridesWriteTimeout(t *testing.T) {
+	config := DefaultConfig()
+	config.ProxyWriteTimeout = -1
+	h := newHTTPHandler(NewUltraMultiplexer(WithConfig(config)), nil)
+	if got := h.routes["/proxy"].WriteTimeout; got != -1 {
+		t.Fatalf("/proxy WriteTimeout = %v, want -1 from ProxyWriteTimeout", got)
+	}
+}
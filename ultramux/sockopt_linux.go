@@ -0,0 +1,17 @@
+package ultramux
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// setReusePort включает SO_REUSEPORT: несколько процессов слушают один
+// порт, и ядро распределяет между ними входящие соединения
+func setReusePort(fd uintptr) error {
+	return unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+}
+
+// setBacklog повторным listen меняет длину очереди уже слушающего сокета;
+// Linux это допускает, значение ограничено net.core.somaxconn
+func setBacklog(fd uintptr, backlog int) error {
+	return unix.Listen(int(fd), backlog)
+}
@@ -0,0 +1,31 @@
+package ultramux
+
+import (
+	"net"
+	"testing"
+)
+
+func TestListenReusePortAndBacklog(t *testing.T) {
+	config := DefaultConfig()
+	config.ReusePort = true
+	config.ListenBacklog = 16
+	first := NewUltraMultiplexerWithConfig("0", config)
+	l1, err := first.listen()
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l1.Close()
+	_, port, _ := net.SplitHostPort(l1.Addr().String())
+
+	// С SO_REUSEPORT второй процесс (здесь - второй мультиплексор) слушает
+	// тот же порт вместо ErrPortInUse
+	second := NewUltraMultiplexerWithConfig(port, config)
+	l2, err := second.listen()
+	if err != nil {
+		t.Fatalf("second listen on port %s: %v", port, err)
+	}
+	defer l2.Close()
+	if second.port != port {
+		t.Fatalf("second listener moved to port %s, want %s", second.port, port)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package ultramux
+
+import (
+	"errors"
+)
+
+var errSockoptUnsupported = errors.New("not supported on this platform")
+
+func setReusePort(fd uintptr) error {
+	return errSockoptUnsupported
+}
+
+func setBacklog(fd uintptr, backlog int) error {
+	return errSockoptUnsupported
+}
@@ -0,0 +1,39 @@
+package ultramux
+
+// State - снимок состояния мультиплексора для супервизоров и встраивающего кода
+type State struct {
+	Lifecycle           string `json:"lifecycle"`
+	Initialized         bool   `json:"initialized"`
+	MuxStarted          bool   `json:"mux_started"`
+	MuxServing          bool   `json:"mux_serving"`
+	ServersReady        bool   `json:"servers_ready"`
+	GRPCClientConnected bool   `json:"grpc_client_connected"`
+	Draining            bool   `json:"draining"`
+	Addr                string `json:"addr,omitempty"`
+}
+
+// State возвращает текущее состояние без сетевых проверок
+func (um *UltraMultiplexer) State() State {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+
+	state := State{
+		Lifecycle:           um.lifecycle.String(),
+		Initialized:         um.lifecycle >= LifecycleInitialized && um.lifecycle < LifecycleStopping,
+		MuxStarted:          um.muxStarted,
+		ServersReady:        um.serversReady,
+		GRPCClientConnected: um.serverReady,
+		Draining:            um.draining,
+	}
+	if um.muxDone != nil {
+		select {
+		case <-um.muxDone:
+		default:
+			state.MuxServing = true
+		}
+	}
+	if um.listener != nil {
+		state.Addr = um.listener.Addr().String()
+	}
+	return state
+}
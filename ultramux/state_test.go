@@ -0,0 +1,33 @@
+package ultramux
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStateFollowsLifecycle(t *testing.T) {
+	um := newTestMultiplexer(t, DefaultConfig())
+	addr := um.config.Listener.Addr().String()
+
+	if state := um.State(); state.Lifecycle != "new" || state.Initialized || state.MuxServing || state.Addr != "" {
+		t.Fatalf("state before Initialize = %+v", state)
+	}
+
+	startErr := startTestMultiplexer(t, um)
+	state := um.State()
+	if state.Lifecycle != "running" || !state.Initialized || !state.MuxStarted || !state.MuxServing || !state.ServersReady || state.Addr != addr {
+		t.Fatalf("running state = %+v", state)
+	}
+
+	// Shutdown, в отличие от Stop, дожидается выхода cmux Serve
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := um.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	waitStartReturned(t, startErr)
+	if state := um.State(); state.Lifecycle != "stopped" || state.Initialized || state.MuxServing {
+		t.Fatalf("state after Shutdown = %+v", state)
+	}
+}
@@ -0,0 +1,484 @@
+package ultramux
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/soheilhy/cmux"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// TLSConfig включает TLS на общем порту. TLS терминируется до cmux, поэтому
+// матчеры протоколов работают с уже расшифрованным трафиком.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// Tenants сопоставляет SNI имя сервера с настройками арендатора.
+	// Клиенты с неизвестным или пустым SNI получают настройки по умолчанию.
+	Tenants map[string]Tenant
+	// MinVersion - минимальная версия TLS (tls.VersionTLS12 по умолчанию);
+	// ниже TLS 1.2 не допускается
+	MinVersion uint16
+	// CipherSuites ограничивает наборы шифров TLS 1.2 (в TLS 1.3 они не
+	// настраиваются). nil - безопасные наборы Go по умолчанию
+	CipherSuites []uint16
+	// StrictALPN закрывает соединения, где протокол по ALPN расходится с
+	// фактическим трафиком (договорились о h2, а пришел HTTP/1.1, и
+	// наоборот). Без него расхождения только логируются и считаются
+	StrictALPN bool
+}
+
+// Tenant - настройки для отдельного SNI имени
+type Tenant struct {
+	// CertFile и KeyFile задают собственный сертификат; иначе используется общий
+	CertFile string
+	KeyFile  string
+	// ProxyAllowedMethods переопределяет Config.ProxyAllowedMethods
+	ProxyAllowedMethods []string
+	// Authenticator переопределяет SetAuthenticator для HTTP запросов и
+	// gRPC вызовов арендатора (и вызовов моста из его HTTP запросов); nil -
+	// общий
+	Authenticator Authenticator
+	// AuthSkipPaths переопределяет Config.AuthSkipPaths; nil - общий список
+	AuthSkipPaths []string
+}
+
+type tenantKey struct{}
+
+type tenantInfo struct {
+	name   string
+	tenant Tenant
+}
+
+// tenantFromContext возвращает арендатора, выбранного по SNI соединения
+func tenantFromContext(ctx context.Context) (string, *Tenant) {
+	info, ok := ctx.Value(tenantKey{}).(*tenantInfo)
+	if !ok {
+		return "", nil
+	}
+	return info.name, &info.tenant
+}
+
+// tenantAuthEnabled - есть ли арендатор с собственным Authenticator
+func (um *UltraMultiplexer) tenantAuthEnabled() bool {
+	if um.config.TLS == nil {
+		return false
+	}
+	for _, tenant := range um.config.TLS.Tenants {
+		if tenant.Authenticator != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (um *UltraMultiplexer) tlsEnabled() bool {
+	return um.config.TLS != nil
+}
+
+func (um *UltraMultiplexer) buildTLSConfig() (*tls.Config, error) {
+	cfg := um.config.TLS
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to load certificate: %w", ErrTLSConfig, err)
+	}
+
+	minVersion, err := tlsMinVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCipherSuites(cfg.CipherSuites); err != nil {
+		return nil, err
+	}
+
+	tenantConfigs := make(map[string]*tls.Config)
+	base := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		// h2 нужен gRPC клиентам, http/1.1 - обычным HTTP клиентам
+		NextProtos:   []string{"h2", "http/1.1"},
+		MinVersion:   minVersion,
+		CipherSuites: cfg.CipherSuites,
+	}
+
+	for name, tenant := range cfg.Tenants {
+		if tenant.CertFile == "" {
+			continue
+		}
+		tenantCert, err := tls.LoadX509KeyPair(tenant.CertFile, tenant.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to load certificate for tenant %s: %w", ErrTLSConfig, name, err)
+		}
+		tenantConfig := base.Clone()
+		tenantConfig.Certificates = []tls.Certificate{tenantCert}
+		tenantConfigs[strings.ToLower(name)] = tenantConfig
+	}
+
+	base.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		// nil означает базовую конфигурацию
+		return tenantConfigs[strings.ToLower(hello.ServerName)], nil
+	}
+	return base, nil
+}
+
+// tenantConnContext кладет в контекст соединения арендатора по SNI
+func (um *UltraMultiplexer) tenantConnContext(ctx context.Context, c net.Conn) context.Context {
+	if info := um.tenantForConn(c); info != nil {
+		return context.WithValue(ctx, tenantKey{}, info)
+	}
+	return ctx
+}
+
+// tenantForConn ищет арендатора по SNI TLS соединения; nil - по умолчанию
+func (um *UltraMultiplexer) tenantForConn(c net.Conn) *tenantInfo {
+	tlsConn, ok := unwrapTLSConn(c)
+	if !ok {
+		return nil
+	}
+
+	// Рукопожатие уже завершено: cmux прочитал начало потока при матчинге
+	serverName := strings.ToLower(tlsConn.ConnectionState().ServerName)
+	return um.tenantByName(serverName)
+}
+
+func (um *UltraMultiplexer) tenantByName(serverName string) *tenantInfo {
+	if serverName == "" {
+		return nil
+	}
+	for name, tenant := range um.config.TLS.Tenants {
+		if strings.EqualFold(name, serverName) {
+			return &tenantInfo{name: name, tenant: tenant}
+		}
+	}
+	return nil
+}
+
+// Метаданные, которыми мост передает арендатора HTTP запроса во
+// внутренний gRPC вызов
+const (
+	bridgeTenantKey = "x-ultramux-tenant"
+	bridgeTokenKey  = "x-ultramux-bridge-token"
+)
+
+func newBridgeToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// tenantAuthInfo - AuthInfo gRPC соединения с арендатором по SNI
+type tenantAuthInfo struct {
+	credentials.CommonAuthInfo
+	tenant *tenantInfo
+}
+
+func (tenantAuthInfo) AuthType() string { return "tls" }
+
+// tenantCredentials - серверные креды gRPC без рукопожатия: TLS уже
+// терминирован до cmux, креды только определяют арендатора по SNI
+type tenantCredentials struct {
+	um *UltraMultiplexer
+}
+
+func (c tenantCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return conn, tenantAuthInfo{
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+		tenant:         c.um.tenantForConn(conn),
+	}, nil
+}
+
+func (tenantCredentials) ClientHandshake(context.Context, string, net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("tenantCredentials: client handshake not supported")
+}
+
+func (tenantCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "tls"}
+}
+
+func (c tenantCredentials) Clone() credentials.TransportCredentials { return c }
+
+func (tenantCredentials) OverrideServerName(string) error { return nil }
+
+// grpcTenant возвращает арендатора gRPC вызова: по SNI соединения, а для
+// вызовов моста - из метаданных, если они подписаны bridgeToken
+func (um *UltraMultiplexer) grpcTenant(ctx context.Context) (string, *Tenant) {
+	if !um.tlsEnabled() {
+		return "", nil
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(tenantAuthInfo); ok && info.tenant != nil {
+			return info.tenant.name, &info.tenant.tenant
+		}
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", nil
+	}
+	names, tokens := md.Get(bridgeTenantKey), md.Get(bridgeTokenKey)
+	if len(names) != 1 || len(tokens) != 1 ||
+		subtle.ConstantTimeCompare([]byte(tokens[0]), []byte(um.bridgeToken)) != 1 {
+		return "", nil
+	}
+	if info := um.tenantByName(names[0]); info != nil {
+		return info.name, &info.tenant
+	}
+	return "", nil
+}
+
+// unwrapTLSConn снимает обертки cmux и мультиплексора до *tls.Conn
+func unwrapTLSConn(c net.Conn) (*tls.Conn, bool) {
+	for {
+		switch conn := c.(type) {
+		case *tls.Conn:
+			return conn, true
+		case *cmux.MuxConn:
+			c = conn.Conn
+		case interface{ NetConn() net.Conn }:
+			c = conn.NetConn()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// alpnExpected - ALPN протокол, которому соответствует трафик протокола cmux
+var alpnExpected = map[string]string{
+	"grpc": "h2",
+	"h2c":  "h2",
+	"http": "http/1.1",
+}
+
+// checkALPN сверяет протокол, согласованный по ALPN, с тем, что cmux
+// определил по первым байтам. Клиенты без ALPN не проверяются. false -
+// соединение нужно закрыть (StrictALPN)
+func (um *UltraMultiplexer) checkALPN(protocol string, conn net.Conn) bool {
+	expected, ok := alpnExpected[protocol]
+	if !ok {
+		return true
+	}
+	tlsConn, ok := unwrapTLSConn(conn)
+	if !ok {
+		return true
+	}
+	negotiated := tlsConn.ConnectionState().NegotiatedProtocol
+	if negotiated == "" || negotiated == expected {
+		return true
+	}
+
+	strict := um.config.TLS != nil && um.config.TLS.StrictALPN
+	um.logger.Printf("⚠️ ALPN mismatch from %s: negotiated %q, but traffic is %s (expected %q), strict=%v",
+		conn.RemoteAddr(), negotiated, protocol, expected, strict)
+	um.metrics.Inc("tls_alpn_mismatch_" + protocol + "_total")
+	return !strict
+}
+
+// Самоподключения (проверки готовности, внутренний gRPC клиент) идут на
+// localhost к собственному сертификату, поэтому проверка цепочки отключена.
+func (um *UltraMultiplexer) selfDialTLSConfig() *tls.Config {
+	return &tls.Config{InsecureSkipVerify: true}
+}
+
+func (um *UltraMultiplexer) selfDialCredentials() credentials.TransportCredentials {
+	if !um.tlsEnabled() {
+		return insecure.NewCredentials()
+	}
+	return credentials.NewTLS(um.selfDialTLSConfig())
+}
+
+func (um *UltraMultiplexer) selfDialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(um.selfDialCredentials()),
+		grpc.WithBlock(),
+	}
+	if dial := um.config.Dialer; dial != nil {
+		opts = append(opts, grpc.WithContextDialer(dial))
+	}
+	return opts
+}
+
+func (um *UltraMultiplexer) selfURL(path string) string {
+	scheme := "http"
+	if um.tlsEnabled() {
+		scheme = "https"
+	}
+	return scheme + "://localhost:" + um.port + path
+}
+
+func (um *UltraMultiplexer) selfHTTPTransport() http.RoundTripper {
+	transport := &http.Transport{
+		// Не оставляем простаивающих соединений к самому себе
+		DisableKeepAlives: true,
+	}
+	if um.tlsEnabled() {
+		transport.TLSClientConfig = um.selfDialTLSConfig()
+	}
+	if dial := um.config.Dialer; dial != nil {
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dial(ctx, addr)
+		}
+	}
+	return transport
+}
+
+func tlsMinVersion(version uint16) (uint16, error) {
+	switch version {
+	case 0:
+		return tls.VersionTLS12, nil
+	case tls.VersionTLS12, tls.VersionTLS13:
+		return version, nil
+	default:
+		return 0, fmt.Errorf("%w: minimum TLS version %s is not allowed, use TLS 1.2 or 1.3", ErrTLSConfig, tls.VersionName(version))
+	}
+}
+
+// validateCipherSuites отклоняет слабые (RC4, 3DES, CBC-SHA256 и т.п.) и
+// неизвестные наборы. HTTP/2 (а значит gRPC) требует
+// ECDHE AES-128-GCM, поэтому без него конфигурация тоже отклоняется.
+func validateCipherSuites(ids []uint16) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	secure := make(map[uint16]bool)
+	for _, suite := range tls.CipherSuites() {
+		secure[suite.ID] = true
+	}
+	insecure := make(map[uint16]bool)
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.ID] = true
+	}
+
+	h2Capable := false
+	for _, id := range ids {
+		switch {
+		case insecure[id]:
+			return fmt.Errorf("%w: weak cipher suite %s", ErrTLSConfig, tls.CipherSuiteName(id))
+		case !secure[id]:
+			return fmt.Errorf("%w: unknown cipher suite 0x%04x", ErrTLSConfig, id)
+		}
+		if id == tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 || id == tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+			h2Capable = true
+		}
+	}
+	if !h2Capable {
+		return fmt.Errorf("%w: cipher suites must include an ECDHE AES-128-GCM suite required by HTTP/2", ErrTLSConfig)
+	}
+	return nil
+}
+
+// UpstreamTLS - настройки TLS для проксирования на HTTPS upstream.
+// По умолчанию сертификат проверяется по системному пулу.
+type UpstreamTLS struct {
+	// CAFile - PEM с CA, которым доверяем вместо системного пула
+	CAFile string
+	// CertFile и KeyFile - клиентский сертификат для mTLS к upstream
+	CertFile string
+	KeyFile  string
+	// ServerName переопределяет имя для проверки сертификата
+	ServerName string
+	// InsecureSkipVerify отключает проверку сертификата (только для dev)
+	InsecureSkipVerify bool
+}
+
+func buildUpstreamTLSConfig(cfg *UpstreamTLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: read upstream CA: %w", ErrTLSConfig, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates in %s", ErrTLSConfig, cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: upstream client certificate: %w", ErrTLSConfig, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// buildProxyTransports загружает TLS настройки target'ов; сами транспорты
+// создаются при первом запросе из транспорта текущего HTTP клиента
+func (um *UltraMultiplexer) buildProxyTransports() error {
+	um.proxyTLS = make(map[*ProxyTarget]*tls.Config)
+	um.proxyTransports = make(map[*ProxyTarget]*http.Transport)
+	um.proxyTransportBases = make(map[*ProxyTarget]*http.Transport)
+	for i := range um.config.ProxyTargets {
+		t := &um.config.ProxyTargets[i]
+		if t.TLS == nil {
+			continue
+		}
+		tlsConfig, err := buildUpstreamTLSConfig(t.TLS)
+		if err != nil {
+			return fmt.Errorf("proxy target %s%s: %w", t.Host, t.PathPrefix, err)
+		}
+		if t.TLS.InsecureSkipVerify {
+			um.logger.Printf("⚠️ Proxy target %s%s: upstream certificate verification disabled", t.Host, t.PathPrefix)
+		}
+		um.proxyTLS[t] = tlsConfig
+	}
+	return nil
+}
+
+// proxyTransport возвращает транспорт для target с собственным TLS: клон
+// транспорта client (SetHTTPClient или по умолчанию), в котором заменен
+// только TLSClientConfig, так что прокси, трассировка и таймауты клиента
+// сохраняются. nil - у target нет своего TLS, нужен транспорт клиента
+func (um *UltraMultiplexer) proxyTransport(t *ProxyTarget, client *http.Client) (*http.Transport, error) {
+	tlsConfig, ok := um.proxyTLS[t]
+	if !ok {
+		return nil, nil
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	baseTransport, ok := base.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("%w: proxy target %s%s has TLS settings, but the HTTP client transport is %T, not *http.Transport", ErrTLSConfig, t.Host, t.PathPrefix, base)
+	}
+
+	um.proxyTransportsMu.Lock()
+	defer um.proxyTransportsMu.Unlock()
+	if transport, ok := um.proxyTransports[t]; ok && um.proxyTransportBases[t] == baseTransport {
+		return transport, nil
+	}
+	transport := baseTransport.Clone()
+	transport.TLSClientConfig = tlsConfig.Clone()
+	if transport.ResponseHeaderTimeout == 0 {
+		// Зависший upstream иначе держал бы запрос весь ProxyWriteTimeout
+		transport.ResponseHeaderTimeout = defaultResponseHeaderTimeout
+	}
+	if old, ok := um.proxyTransports[t]; ok {
+		// Клиент подменили через SetHTTPClient
+		old.CloseIdleConnections()
+	}
+	um.proxyTransports[t] = transport
+	um.proxyTransportBases[t] = baseTransport
+	return transport, nil
+}
@@ -0,0 +1,263 @@
+package ultramux
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// writeTestCert пишет самоподписанный сертификат для localhost во
+// временный каталог и возвращает пути к сертификату и ключу
+func writeTestCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+// pingService - минимальный gRPC сервис для проверок цепочки interceptor'ов
+var pingService = grpc.ServiceDesc{
+	ServiceName: "ultramux.test.Ping",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Ping",
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(emptypb.Empty)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) { return &emptypb.Empty{}, nil }
+			if interceptor == nil {
+				return handler(ctx, in)
+			}
+			return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/ultramux.test.Ping/Ping"}, handler)
+		},
+	}},
+}
+
+func registerPingService(s *grpc.Server) {
+	s.RegisterService(&pingService, struct{}{})
+}
+
+func pingAs(t *testing.T, addr, serverName string) codes.Code {
+	t.Helper()
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	})))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = conn.Invoke(ctx, "/ultramux.test.Ping/Ping", &emptypb.Empty{}, &emptypb.Empty{})
+	return status.Code(err)
+}
+
+func TestGRPCTenantAuthenticator(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+
+	tests := []struct {
+		name        string
+		global      Authenticator
+		tenant      Authenticator
+		wantTenant  codes.Code
+		wantDefault codes.Code
+	}{
+		{"tenant overrides global", rejectAllAuthenticator{}, acceptAllAuthenticator{}, codes.OK, codes.Unauthenticated},
+		{"tenant only", nil, rejectAllAuthenticator{}, codes.Unauthenticated, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.TLS = &TLSConfig{
+				CertFile: certFile,
+				KeyFile:  keyFile,
+				Tenants:  map[string]Tenant{"a.example": {Authenticator: tt.tenant}},
+			}
+			um := newTestMultiplexer(t, config)
+			if tt.global != nil {
+				um.SetAuthenticator(tt.global)
+			}
+			um.RegisterGRPCService(registerPingService)
+			addr := um.config.Listener.Addr().String()
+			startTestMultiplexer(t, um)
+
+			if got := pingAs(t, addr, "A.example"); got != tt.wantTenant {
+				t.Errorf("tenant call: %s, want %s", got, tt.wantTenant)
+			}
+			if got := pingAs(t, addr, "localhost"); got != tt.wantDefault {
+				t.Errorf("default call: %s, want %s", got, tt.wantDefault)
+			}
+		})
+	}
+}
+
+func TestGRPCTenantFromBridgeMetadata(t *testing.T) {
+	config := DefaultConfig()
+	config.TLS = &TLSConfig{Tenants: map[string]Tenant{"a.example": {}}}
+	um := NewUltraMultiplexer(WithConfig(config))
+
+	httpCtx := context.WithValue(context.Background(), tenantKey{}, &tenantInfo{name: "a.example"})
+	out, _ := metadata.FromOutgoingContext(um.forwardCredentials(httpCtx))
+	if name, _ := um.grpcTenant(metadata.NewIncomingContext(context.Background(), out)); name != "a.example" {
+		t.Fatalf("bridge tenant = %q, want a.example", name)
+	}
+
+	// Без токена моста метаданным клиента не доверяем
+	spoofed := metadata.Pairs(bridgeTenantKey, "a.example", bridgeTokenKey, "guess")
+	if name, _ := um.grpcTenant(metadata.NewIncomingContext(context.Background(), spoofed)); name != "" {
+		t.Fatalf("spoofed tenant accepted: %q", name)
+	}
+}
+
+func TestPlaintextPortRejectsTLS(t *testing.T) {
+	um := newTestMultiplexer(t, DefaultConfig())
+	addr := um.config.Listener.Addr().String()
+	startTestMultiplexer(t, um)
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err == nil {
+		conn.Close()
+		t.Fatal("TLS handshake succeeded on a plaintext port")
+	}
+
+	// Счетчик обновляется до закрытия соединения
+	counters, _ := um.metrics.Snapshot()["counters"].(map[string]int64)
+	if counters["tls_on_plaintext_rejected_total"] != 1 {
+		t.Fatalf("tls_on_plaintext_rejected_total not counted: %v", counters)
+	}
+}
+
+func TestBuildTLSConfigPolicy(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+
+	tests := []struct {
+		name           string
+		minVersion     uint16
+		cipherSuites   []uint16
+		wantMinVersion uint16
+		wantErr        bool
+	}{
+		{"default", 0, nil, tls.VersionTLS12, false},
+		{"TLS 1.3 only", tls.VersionTLS13, nil, tls.VersionTLS13, false},
+		{"TLS 1.1 rejected", tls.VersionTLS11, nil, 0, true},
+		{"restricted suites", 0, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305}, tls.VersionTLS12, false},
+		{"weak suite", 0, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_RSA_WITH_RC4_128_SHA}, 0, true},
+		{"unknown suite", 0, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, 0xfeee}, 0, true},
+		{"no HTTP/2 suite", 0, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.TLS = &TLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: tt.minVersion, CipherSuites: tt.cipherSuites}
+			tlsConfig, err := NewUltraMultiplexer(WithConfig(config)).buildTLSConfig()
+			if tt.wantErr {
+				if !errors.Is(err, ErrTLSConfig) {
+					t.Fatalf("err = %v, want ErrTLSConfig", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildTLSConfig: %v", err)
+			}
+			if tlsConfig.MinVersion != tt.wantMinVersion {
+				t.Fatalf("MinVersion = %s, want %s", tls.VersionName(tlsConfig.MinVersion), tls.VersionName(tt.wantMinVersion))
+			}
+		})
+	}
+}
+
+func TestALPNMismatch(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+
+	tests := []struct {
+		name       string
+		strict     bool
+		wantServed bool
+	}{
+		{"logged only", false, true},
+		{"strict closes", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.TLS = &TLSConfig{CertFile: certFile, KeyFile: keyFile, StrictALPN: tt.strict}
+			um := newTestMultiplexer(t, config)
+			addr := um.config.Listener.Addr().String()
+			startTestMultiplexer(t, um)
+
+			// Клиент согласовал h2, но шлет HTTP/1.1
+			conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", addr, &tls.Config{
+				InsecureSkipVerify: true,
+				NextProtos:         []string{"h2"},
+			})
+			if err != nil {
+				t.Fatalf("TLS dial: %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			if _, err := conn.Write([]byte("GET /health HTTP/1.1\r\nHost: localhost\r\n\r\n")); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if served := err == nil && resp.StatusCode == http.StatusOK; served != tt.wantServed {
+				t.Fatalf("served = %v (err %v), want %v", served, err, tt.wantServed)
+			}
+
+			counters, _ := um.metrics.Snapshot()["counters"].(map[string]int64)
+			if counters["tls_alpn_mismatch_http_total"] != 1 {
+				t.Fatalf("tls_alpn_mismatch_http_total not counted: %v", counters)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package ultramux
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ResponseTransformer меняет ответ upstream'а в /proxy до отправки клиенту:
+// заголовки, статус и тело. Тело можно обернуть потоковым reader'ом или
+// заменить; исходный resp.Body закроет сам прокси. Ошибка превращается в
+// 502 для клиента
+type ResponseTransformer func(resp *http.Response) error
+
+type responseTransformer struct {
+	contentTypes []string
+	transform    ResponseTransformer
+}
+
+// RegisterResponseTransformer добавляет трансформер ответов /proxy.
+// contentTypes ограничивает его типами ответа (как ProxyAllowedContentTypes:
+// "text/html", "application/*"); пустой - любые ответы. Трансформеры
+// выполняются в порядке регистрации, каждый видит результат предыдущего,
+// и тип проверяется по текущему Content-Type.
+// Должен вызываться до Initialize.
+func (um *UltraMultiplexer) RegisterResponseTransformer(contentTypes []string, transform ResponseTransformer) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.responseTransformers = append(um.responseTransformers, responseTransformer{
+		contentTypes: contentTypes,
+		transform:    transform,
+	})
+}
+
+// transformResponse применяет подходящие трансформеры. Если тело
+// подменено, его длина больше не известна: Content-Length снимается, а
+// сильный ETag становится слабым - байты уже не те, что у upstream'а
+func (um *UltraMultiplexer) transformResponse(resp *http.Response) error {
+	if len(um.responseTransformers) == 0 {
+		return nil
+	}
+	original := resp.Body
+	for _, t := range um.responseTransformers {
+		if len(t.contentTypes) > 0 && !contentTypeAllowed(resp.Header.Get("Content-Type"), t.contentTypes) {
+			continue
+		}
+		if err := t.transform(resp); err != nil {
+			return err
+		}
+		um.metrics.Inc("proxy_response_transformed_total")
+	}
+	if resp.Body == original {
+		return nil
+	}
+	if resp.Body == nil {
+		resp.Body = http.NoBody
+	}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		resp.Header.Set("ETag", "W/"+etag)
+	}
+	return nil
+}
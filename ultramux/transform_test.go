@@ -0,0 +1,68 @@
+package ultramux
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestProxyResponseTransformers(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, "hello")
+	}))
+	defer upstream.Close()
+
+	um := NewUltraMultiplexer()
+	um.RegisterResponseTransformer([]string{"text/plain"}, func(resp *http.Response) error {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		resp.Body = io.NopCloser(strings.NewReader(strings.ToUpper(string(body))))
+		resp.Header.Set("Content-Type", "text/x-upper")
+		return nil
+	})
+	// Видит Content-Type, выставленный предыдущим трансформером
+	um.RegisterResponseTransformer([]string{"text/x-upper"}, func(resp *http.Response) error {
+		resp.Header.Set("X-Transformed", "upper")
+		return nil
+	})
+	um.RegisterResponseTransformer([]string{"application/json"}, func(resp *http.Response) error {
+		return errors.New("broken JSON")
+	})
+	handler := newHTTPHandler(um, nil)
+
+	tests := []struct {
+		contentType string
+		want        int
+		wantBody    string
+		wantETag    string
+		wantHeader  string
+	}{
+		{"text/plain", http.StatusOK, "HELLO", `W/"v1"`, "upper"},
+		{"image/png", http.StatusOK, "hello", `"v1"`, ""},
+		{"application/json", http.StatusBadGateway, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			target := upstream.URL + "/?type=" + url.QueryEscape(tt.contentType)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy?target="+url.QueryEscape(target), nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			if rec.Body.String() != tt.wantBody || rec.Header().Get("ETag") != tt.wantETag || rec.Header().Get("X-Transformed") != tt.wantHeader {
+				t.Fatalf("body %q, ETag %q, X-Transformed %q", rec.Body, rec.Header().Get("ETag"), rec.Header().Get("X-Transformed"))
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package ultramux
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "ultramultiplexer/pb/pb"
+)
+
+// maxDataLength - максимальная длина DataRequest.data в символах
+const maxDataLength = 64 << 10
+
+// invalidArgument собирает codes.InvalidArgument с errdetails.BadRequest,
+// чтобы клиенты (и /grpc-call) получали ошибки по отдельным полям
+func invalidArgument(violations ...*errdetails.BadRequest_FieldViolation) error {
+	st := status.New(codes.InvalidArgument, "invalid request")
+	detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+func validateDataRequest(req *pb.DataRequest) error {
+	var violations []*errdetails.BadRequest_FieldViolation
+	switch length := utf8.RuneCountInString(req.Data); {
+	case length == 0:
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       "data",
+			Description: "must not be empty",
+		})
+	case length > maxDataLength:
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       "data",
+			Description: fmt.Sprintf("must be at most %d characters, got %d", maxDataLength, length),
+		})
+	}
+
+	if len(violations) > 0 {
+		return invalidArgument(violations...)
+	}
+	return nil
+}
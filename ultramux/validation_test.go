@@ -0,0 +1,50 @@
+package ultramux
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "ultramultiplexer/pb/pb"
+)
+
+func TestValidateDataRequestFieldViolations(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantDesc string
+	}{
+		{"valid", "hello", ""},
+		{"empty", "", "must not be empty"},
+		{"too long", strings.Repeat("я", maxDataLength+1), "must be at most"},
+		{"multibyte at the limit", strings.Repeat("я", maxDataLength), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDataRequest(&pb.DataRequest{Data: tt.data})
+			if tt.wantDesc == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			st := status.Convert(err)
+			if st.Code() != codes.InvalidArgument {
+				t.Fatalf("code = %s, want InvalidArgument", st.Code())
+			}
+			var violations []*errdetails.BadRequest_FieldViolation
+			for _, detail := range st.Details() {
+				if br, ok := detail.(*errdetails.BadRequest); ok {
+					violations = append(violations, br.GetFieldViolations()...)
+				}
+			}
+			if len(violations) != 1 || violations[0].GetField() != "data" || !strings.HasPrefix(violations[0].GetDescription(), tt.wantDesc) {
+				t.Fatalf("violations = %v", violations)
+			}
+		})
+	}
+}
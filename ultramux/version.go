@@ -0,0 +1,4 @@
+package ultramux
+
+// Version - версия мультиплексора (User-Agent прокси, OpenAPI)
+const Version = "1.0.0"
@@ -0,0 +1,93 @@
+package ultramux
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// WorkerPoolConfig ограничивает число одновременно выполняемых gRPC
+// обработчиков независимо от числа принятых стримов. Сверх Size вызовы ждут
+// в очереди глубиной QueueDepth, при полной очереди - ResourceExhausted.
+type WorkerPoolConfig struct {
+	Size       int
+	QueueDepth int
+}
+
+// handlerPool - семафор на Size слотов со счетчиком ожидающих
+type handlerPool struct {
+	slots      chan struct{}
+	queueDepth int64
+	queued     atomic.Int64
+}
+
+func newHandlerPool(cfg WorkerPoolConfig) *handlerPool {
+	if cfg.Size <= 0 {
+		return nil
+	}
+	return &handlerPool{
+		slots:      make(chan struct{}, cfg.Size),
+		queueDepth: int64(cfg.QueueDepth),
+	}
+}
+
+// acquire занимает слот; ошибка - очередь полна или вызов отменен в очереди
+func (p *handlerPool) acquire(ctx context.Context) error {
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if p.queued.Add(1) > p.queueDepth {
+		p.queued.Add(-1)
+		return status.Error(codes.ResourceExhausted, "server is overloaded, try again later")
+	}
+	defer p.queued.Add(-1)
+
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+func (p *handlerPool) release() {
+	<-p.slots
+}
+
+// pooled: health проверки не должны стоять в очереди за нагрузкой
+func pooled(method string) bool {
+	return !strings.HasPrefix(method, "/grpc.health.v1.")
+}
+
+func (um *UltraMultiplexer) workerPoolUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !pooled(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	if err := um.handlerPool.acquire(ctx); err != nil {
+		um.metrics.Inc("grpc_pool_rejected_total")
+		return nil, err
+	}
+	defer um.handlerPool.release()
+
+	return handler(ctx, req)
+}
+
+func (um *UltraMultiplexer) workerPoolStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !pooled(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	if err := um.handlerPool.acquire(ss.Context()); err != nil {
+		um.metrics.Inc("grpc_pool_rejected_total")
+		return err
+	}
+	defer um.handlerPool.release()
+
+	return handler(srv, ss)
+}
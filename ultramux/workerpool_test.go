@@ -0,0 +1,52 @@
+package ultramux
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHandlerPoolQueueAndShedding(t *testing.T) {
+	pool := newHandlerPool(WorkerPoolConfig{Size: 1, QueueDepth: 1})
+	if err := pool.acquire(context.Background()); err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+
+	// Второй вызов ждет в очереди, пока слот не освободится
+	queued := make(chan error, 1)
+	go func() { queued <- pool.acquire(context.Background()) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.queued.Load() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("second call never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Очередь полна - третий отклоняется сразу
+	if err := pool.acquire(context.Background()); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("acquire with a full queue = %v, want ResourceExhausted", err)
+	}
+
+	pool.release()
+	if err := <-queued; err != nil {
+		t.Fatalf("queued acquire: %v", err)
+	}
+
+	// Отмена в очереди возвращает код контекста
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := pool.acquire(ctx); status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("acquire after deadline = %v, want DeadlineExceeded", err)
+	}
+	pool.release()
+}
+
+func TestHandlerPoolDisabled(t *testing.T) {
+	if pool := newHandlerPool(WorkerPoolConfig{}); pool != nil {
+		t.Fatal("pool created with zero size")
+	}
+}